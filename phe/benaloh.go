@@ -1,62 +1,74 @@
 package phe
 
 import (
-	cRand "crypto/rand"
+	"crypto/sha256"
+	"io"
 	"math/big"
-	mRand "math/rand"
-	"sort"
 )
 
-type rootPower struct {
-	power uint64
-	num   *big.Int
-}
-
 // PublicBenaloh represents the public key in the Paillier cryptosystem
 type PublicBenaloh struct {
-	y    *big.Int
-	yInv *big.Int
-	n    *big.Int
-	rBig *big.Int
-	r    uint64
-	rn   *mRand.Rand
+	y      *big.Int
+	yInv   *big.Int
+	n      *big.Int
+	r      *big.Int
+	random io.Reader
+	bind   binding
+	ctxs   *modContextPool // modulo n, see modCtx
+	// yTable and yInvTable are only set by WithEncryptionTables
+	yTable    *fixedBaseTable
+	yInvTable *fixedBaseTable
 }
 
 // SecretBenaloh represents the secret key in the Paillier crypstosystem
+//
+// Besides phi it keeps the prime factor p of n such that r | p - 1, the
+// decryption works modulo p, and one decryption table per prime power
+// factor of r
+//
+// A SecretBenaloh can decrypt from several go routines at once without
+// being copied, and its copies don't duplicate the decryption tables
 type SecretBenaloh struct {
-	phi         *big.Int
-	n           *big.Int
-	rBig        *big.Int
-	r           uint64
-	sqrtR       uint64
-	phiOverR    *big.Int
-	xInvPowers  []*big.Int
-	xSqrtPowers []rootPower
+	phi     *big.Int
+	n       *big.Int
+	y       *big.Int
+	r       *big.Int
+	p       *big.Int
+	pOverR  *big.Int        // (p - 1) / r
+	pCtxs   *modContextPool // modulo p
+	factors []benalohFactor
+	bind    binding
+	guard   *big.Int // see WithGuardBand
 }
 
 // CopyPublicBenaloh to PublicBenaloh
 func CopyPublicBenaloh(p PublicBenaloh) PublicBenaloh {
 	return PublicBenaloh{
-		y:    copyInt(p.y),
-		yInv: copyInt(p.yInv),
-		n:    copyInt(p.n),
-		rBig: copyInt(p.rBig),
-		r:    p.r,
-		rn:   mRand.New(mRand.NewSource(p.rn.Int63())),
+		y:         copyInt(p.y),
+		yInv:      copyInt(p.yInv),
+		n:         copyInt(p.n),
+		r:         copyInt(p.r),
+		random:    p.random,
+		bind:      p.bind,
+		ctxs:      p.ctxs,
+		yTable:    p.yTable,
+		yInvTable: p.yInvTable,
 	}
 }
 
 // CopySecretBenaloh to SecretBenaloh
 func CopySecretBenaloh(s SecretBenaloh) SecretBenaloh {
 	return SecretBenaloh{
-		phi:         copyInt(s.phi),
-		n:           copyInt(s.n),
-		rBig:        copyInt(s.rBig),
-		r:           s.r,
-		sqrtR:       s.sqrtR,
-		phiOverR:    copyInt(s.phiOverR),
-		xInvPowers:  copyIntSlice(s.xInvPowers),
-		xSqrtPowers: copyRootPowerSlice(s.xSqrtPowers),
+		phi:     copyInt(s.phi),
+		n:       copyInt(s.n),
+		y:       copyInt(s.y),
+		r:       copyInt(s.r),
+		p:       copyInt(s.p),
+		pOverR:  copyInt(s.pOverR),
+		pCtxs:   s.pCtxs,
+		factors: s.factors,
+		bind:    s.bind,
+		guard:   copyIntOrNil(s.guard),
 	}
 }
 
@@ -71,96 +83,450 @@ func (s SecretBenaloh) Copy() SecretKey {
 }
 
 // MulUint64 multiplies one ciphertext with a uint64 plaintext
+//
+// It panics if the ciphertext was produced by another key, see MulUint64E
 func (p PublicBenaloh) MulUint64(a *Ciphertext, b uint64) *Ciphertext {
-	return &Ciphertext{num: powModUint64(a.num, b, p.n)}
+	return mustCiphertext(p.MulUint64E(a, b))
+}
+
+// MulUint64E multiplies one ciphertext with a uint64 plaintext in the
+// same way as MulUint64 but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicBenaloh) MulUint64E(a *Ciphertext, b uint64) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.exp(nInt(), a.num, nIntSetUint64(b), 64, nil), bind: p.bind}, nil
 }
 
 // MulInt multiplies one ciphertext with a plaintext of arbitrary size
+//
+// It panics if the ciphertext was produced by another key, see MulIntE
 func (p PublicBenaloh) MulInt(a *Ciphertext, b *big.Int) *Ciphertext {
-	if a.num.Sign() < 0 {
-		return &Ciphertext{num: powMod(invMod(a.num, p.n), nInt().Abs(b), p.n)}
+	return mustCiphertext(p.MulIntE(a, b))
+}
+
+// MulIntE multiplies one ciphertext with a plaintext of arbitrary size in
+// the same way as MulInt but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+//
+// The plaintext is taken mod r so a negative b becomes r - |b| and
+// the ciphertext never has to be inverted
+func (p PublicBenaloh) MulIntE(a *Ciphertext, b *big.Int) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
 	}
-	return &Ciphertext{num: powMod(a.num, b, p.n)}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.exp(nInt(), a.num, nInt().Mod(b, p.r), p.r.BitLen(), nil), bind: p.bind}, nil
 }
 
 // MulInt64 multiplies one ciphertext with a int64 plaintext
+//
+// It panics if the ciphertext was produced by another key, see MulInt64E
 func (p PublicBenaloh) MulInt64(a *Ciphertext, b int64) *Ciphertext {
 	return p.MulInt(a, nIntSetInt64(b))
 }
 
+// MulInt64E multiplies one ciphertext with a int64 plaintext in the
+// same way as MulInt64 but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicBenaloh) MulInt64E(a *Ciphertext, b int64) (*Ciphertext, error) {
+	return p.MulIntE(a, nIntSetInt64(b))
+}
+
 // GetPlaintextMod returns the mod over which all
 // plaintext operations are done
 //
-// In Benaloh cryptosystem it correspond to r
-func (p PublicBenaloh) GetPlaintextMod() uint64 {
-	return p.r
+// In Benaloh cryptosystem it correspond to r, see also PlaintextModulus
+func (p PublicBenaloh) GetPlaintextMod() *big.Int {
+	return copyInt(p.r)
+}
+
+// PlaintextModulus returns r, the plaintexts are integers mod r
+func (p PublicBenaloh) PlaintextModulus() *big.Int {
+	return copyInt(p.r)
+}
+
+// CiphertextModulus returns n, the ciphertexts are integers mod n
+func (p PublicBenaloh) CiphertextModulus() *big.Int {
+	return copyInt(p.n)
+}
+
+// SecurityBits returns the security level in bits of the key, which
+// depends on the size of n
+func (p PublicBenaloh) SecurityBits() int {
+	return securityBits(p.n.BitLen())
+}
+
+func (p PublicBenaloh) keyBinding() binding {
+	return p.bind
+}
+
+// Fingerprint returns the SHA-256 hash of the binary encoding of the key
+func (p PublicBenaloh) Fingerprint() [sha256.Size]byte {
+	return p.bind.key
+}
+
+// Fingerprint returns the fingerprint of the public key matching
+// the secret key
+func (s SecretBenaloh) Fingerprint() [sha256.Size]byte {
+	return s.bind.key
+}
+
+// Validate checks that the ciphertext is in (0, n) and coprime
+// with n, otherwise it returns ErrInvalidCiphertext
+//
+// Ciphertexts received from untrusted parties should be validated before
+// any operation, ValidateVector checks many of them at once
+func (p PublicBenaloh) Validate(c *Ciphertext) error {
+	return validateCiphertext(c, p.n, p.n)
 }
 
-func (p PublicBenaloh) randInt() (ans *big.Int) {
-	ans, _ = cRand.Int(p.rn, p.n)
-	return
+func (p PublicBenaloh) validationModuli() (bound, n *big.Int) {
+	return p.n, p.n
+}
+
+// modCtx returns a ModContext modulo n that belongs to the caller
+// until it is given back with release, so the key can be used by several
+// go routines at once
+func (p PublicBenaloh) modCtx() *ModContext {
+	if p.ctxs == nil {
+		return newModContext(newMontModulus(p.n))
+	}
+	return p.ctxs.get()
+}
+
+func (p PublicBenaloh) release(ctx *ModContext) {
+	if p.ctxs != nil {
+		p.ctxs.put(ctx)
+	}
+}
+
+// yPow returns y ** m mod n for the plaintext m taken mod r
+//
+// y ** r is an r-th residue so reducing m modulo r doesn't change the
+// decryption. With the encryption tables a negative m goes through the
+// powers of y ** (-1), otherwise it becomes r - |m|
+func (p PublicBenaloh) yPow(m *big.Int) *big.Int {
+	if p.yTable != nil {
+		e := bigMod(nInt().Abs(m), p.r)
+		if m.Sign() >= 0 {
+			return p.yTable.exp(e)
+		}
+		return p.yInvTable.exp(e)
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return ctx.exp(nInt(), p.y, nInt().Mod(m, p.r), p.r.BitLen(), nil)
+}
+
+func (p PublicBenaloh) randInt() (*big.Int, error) {
+	return randomUnit(p.random, p.n)
 }
 
 // Add adds two ciphertexts
 //
 // In Benaloh cryptosystem addition is the same as multiplication
 // over ciphertexts
+//
+// It panics if the ciphertexts were produced by another key, see AddE
 func (p PublicBenaloh) Add(a, b *Ciphertext) *Ciphertext {
-	return &Ciphertext{num: bigMod(mulNew(a.num, b.num), p.n)}
+	return mustCiphertext(p.AddE(a, b))
+}
+
+// AddE adds two ciphertexts in the same way as Add but returns
+// ErrKeyMismatch if any of them was produced by another key
+func (p PublicBenaloh) AddE(a, b *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, a, b); err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(nInt(), a.num, b.num), bind: p.bind}, nil
+}
+
+// WithEncryptionTables returns a copy of the key that computes y ** m
+// and y ** (-m) with precomputed tables of fixed-base powers, which
+// removes all the squarings from that part of the encryption
+//
+// The tables take about r.BitLen() / 4 * 16 integers of the size of n
+// each
+func (p PublicBenaloh) WithEncryptionTables() PublicBenaloh {
+	width := p.r.BitLen()
+	p.yTable = newFixedBaseTable(p.y, p.n, width)
+	p.yInvTable = newFixedBaseTable(p.yInv, p.n, width)
+	return p
+}
+
+// Sub subtracts the ciphertext b from a
+//
+// b is inverted modulo n instead of being raised to the power -1, which
+// costs a gcd instead of an exponentiation
+//
+// It panics if the ciphertexts were produced by another key, see SubE
+func (p PublicBenaloh) Sub(a, b *Ciphertext) *Ciphertext {
+	return mustCiphertext(p.SubE(a, b))
+}
+
+// SubE subtracts two ciphertexts in the same way as Sub but returns
+// ErrKeyMismatch if any of them was produced by another key and
+// ErrInvalidCiphertext if b isn't invertible
+func (p PublicBenaloh) SubE(a, b *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, a, b); err != nil {
+		return nil, err
+	}
+	bInv, err := invertCiphertext(b, p.n)
+	if err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(bInv, bInv, a.num), bind: p.bind}, nil
+}
+
+// Neg returns a ciphertext of the opposite of the plaintext of a
+//
+// It panics if the ciphertext was produced by another key, see NegE
+func (p PublicBenaloh) Neg(a *Ciphertext) *Ciphertext {
+	return mustCiphertext(p.NegE(a))
+}
+
+// NegE negates a ciphertext in the same way as Neg but returns
+// ErrKeyMismatch if it was produced by another key and
+// ErrInvalidCiphertext if it isn't invertible
+func (p PublicBenaloh) NegE(a *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
+	}
+	inv, err := invertCiphertext(a, p.n)
+	if err != nil {
+		return nil, err
+	}
+	return &Ciphertext{num: inv, bind: p.bind}, nil
+}
+
+// AddPlainUint64 adds a uint64 plaintext to a ciphertext
+//
+// It panics if the ciphertext was produced by another key, see
+// AddPlainUint64E
+func (p PublicBenaloh) AddPlainUint64(a *Ciphertext, m uint64) *Ciphertext {
+	return mustCiphertext(p.AddPlainUint64E(a, m))
+}
+
+// AddPlainUint64E adds a uint64 plaintext to a ciphertext in the same way
+// as AddPlainUint64 but returns ErrKeyMismatch if the ciphertext was
+// produced by another key
+func (p PublicBenaloh) AddPlainUint64E(a *Ciphertext, m uint64) (*Ciphertext, error) {
+	return p.AddPlainIntE(a, nIntSetUint64(m))
+}
+
+// AddPlainInt adds a plaintext of arbitrary size to a ciphertext
+//
+// The ciphertext is multiplied by y ** (m mod r) and gets no fresh
+// randomness so it can be linked to a, see Rerandomize
+//
+// It panics if the ciphertext was produced by another key, see
+// AddPlainIntE
+func (p PublicBenaloh) AddPlainInt(a *Ciphertext, m *big.Int) *Ciphertext {
+	return mustCiphertext(p.AddPlainIntE(a, m))
+}
+
+// AddPlainIntE adds a plaintext of arbitrary size to a ciphertext in the
+// same way as AddPlainInt but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicBenaloh) AddPlainIntE(a *Ciphertext, m *big.Int) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
+	}
+	ym := p.yPow(m)
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(ym, ym, a.num), bind: p.bind}, nil
+}
+
+// SubPlainUint64 subtracts a uint64 plaintext from a ciphertext
+//
+// It panics if the ciphertext was produced by another key, see
+// SubPlainUint64E
+func (p PublicBenaloh) SubPlainUint64(a *Ciphertext, m uint64) *Ciphertext {
+	return mustCiphertext(p.SubPlainUint64E(a, m))
+}
+
+// SubPlainUint64E subtracts a uint64 plaintext from a ciphertext in the
+// same way as SubPlainUint64 but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicBenaloh) SubPlainUint64E(a *Ciphertext, m uint64) (*Ciphertext, error) {
+	return p.AddPlainIntE(a, nInt().Neg(nIntSetUint64(m)))
+}
+
+// SubPlainInt subtracts a plaintext of arbitrary size from a ciphertext
+//
+// It panics if the ciphertext was produced by another key, see
+// SubPlainIntE
+func (p PublicBenaloh) SubPlainInt(a *Ciphertext, m *big.Int) *Ciphertext {
+	return mustCiphertext(p.SubPlainIntE(a, m))
+}
+
+// SubPlainIntE subtracts a plaintext of arbitrary size from a ciphertext
+// in the same way as SubPlainInt but returns ErrKeyMismatch if the
+// ciphertext was produced by another key
+func (p PublicBenaloh) SubPlainIntE(a *Ciphertext, m *big.Int) (*Ciphertext, error) {
+	return p.AddPlainIntE(a, nInt().Neg(m))
+}
+
+// Rerandomize returns a ciphertext of the same plaintext as c that can't
+// be linked to it, c * u ** r mod n for a fresh u
+//
+// It panics if the ciphertext was produced by another key or if the
+// entropy source fails, see RerandomizeE
+func (p PublicBenaloh) Rerandomize(c *Ciphertext) *Ciphertext {
+	return mustCiphertext(p.RerandomizeE(c))
+}
+
+// RerandomizeE rerandomizes a ciphertext in the same way as Rerandomize
+// but returns ErrKeyMismatch if it was produced by another key and
+// ErrEntropy if the entropy source fails
+func (p PublicBenaloh) RerandomizeE(c *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, c); err != nil {
+		return nil, err
+	}
+	u, err := p.randInt()
+	if err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	ur := ctx.exp(u, u, p.r, p.r.BitLen(), nil)
+	return &Ciphertext{num: ctx.Mul(ur, ur, c.num), bind: p.bind}, nil
 }
 
 // EncryptUint64 encrypts a single uint64 integer
 // using the formula ((y ** m) * (u ** r)) mod n
 // where u is a chosen randomly
+//
+// It panics if the entropy source fails, see EncryptUint64E
 func (p PublicBenaloh) EncryptUint64(m uint64) *Ciphertext {
-	ym := powModUint64(p.y, m, p.n)
-	ur := powModUint64(p.randInt(), p.r, p.n)
-	return &Ciphertext{num: bigMod(mulNew(ym, ur), p.n)}
+	return mustCiphertext(p.EncryptUint64E(m))
 }
 
-// EncryptInt encrypts an integer of arbitrary size
-func (p PublicBenaloh) EncryptInt(m *big.Int) *Ciphertext {
+// EncryptUint64E encrypts a single uint64 integer in the same way as
+// EncryptUint64 but returns ErrEntropy if the entropy source fails
+func (p PublicBenaloh) EncryptUint64E(m uint64) (*Ciphertext, error) {
+	u, err := p.randInt()
+	if err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
 	var ym *big.Int
-	if m.Sign() >= 0 {
-		ym = powMod(p.y, m, p.n)
+	if p.yTable != nil {
+		ym = p.yTable.exp(bigMod(nIntSetUint64(m), p.r))
 	} else {
-		ym = powMod(p.yInv, nInt().Abs(m), p.n)
+		// all the 64 bits of m are gone through, it is often secret
+		ym = ctx.exp(nInt(), p.y, nIntSetUint64(m), 64, nil)
+	}
+	ur := ctx.exp(u, u, p.r, p.r.BitLen(), nil)
+	return &Ciphertext{num: ctx.Mul(ym, ym, ur), bind: p.bind}, nil
+}
+
+// EncryptInt encrypts an integer of arbitrary size
+//
+// It panics if the entropy source fails, see EncryptIntE
+func (p PublicBenaloh) EncryptInt(m *big.Int) *Ciphertext {
+	return mustCiphertext(p.EncryptIntE(m))
+}
+
+// EncryptIntE encrypts an integer of arbitrary size in the same way as
+// EncryptInt but returns ErrEntropy if the entropy source fails
+func (p PublicBenaloh) EncryptIntE(m *big.Int) (*Ciphertext, error) {
+	u, err := p.randInt()
+	if err != nil {
+		return nil, err
 	}
-	ur := powModUint64(p.randInt(), p.r, p.n)
-	return &Ciphertext{num: bigMod(mulNew(ym, ur), p.n)}
+	ym := p.yPow(m)
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	ur := ctx.exp(u, u, p.r, p.r.BitLen(), nil)
+	return &Ciphertext{num: ctx.Mul(ym, ym, ur), bind: p.bind}, nil
 }
 
 // EncryptInt64 encrypts a single int64 integer
+//
+// It panics if the entropy source fails, see EncryptInt64E
 func (p PublicBenaloh) EncryptInt64(m int64) *Ciphertext {
 	return p.EncryptInt(nIntSetInt64(m))
 }
 
+// EncryptInt64E encrypts a single int64 integer in the same way as
+// EncryptInt64 but returns ErrEntropy if the entropy source fails
+func (p PublicBenaloh) EncryptInt64E(m int64) (*Ciphertext, error) {
+	return p.EncryptIntE(nIntSetInt64(m))
+}
+
 // IsZero quickly checks if the plaintext is 0 or not
 // It's preffered when r is big enough
 func (s SecretBenaloh) IsZero(c *Ciphertext) bool {
-	return powMod(c.num, s.phiOverR, s.n).Cmp(oneInt) == 0
+	return s.pCtxs.exp(c.num, s.pOverR, s.p.BitLen()).Cmp(oneInt) == 0
 }
 
 // Decrypt decrypts a ciphertext by finding an m
-// such that x ** m = c ** (phi / r) mod n
+// such that x ** m = c ** ((p - 1) / r) mod p
+//
+// It panics if there is no such m, see DecryptE
 func (s SecretBenaloh) Decrypt(c *Ciphertext) *big.Int {
-	// a = c ** (phi / r) mod n
-	a := powMod(c.num, s.phiOverR, s.n)
-	for power, num := range s.xInvPowers {
-		// sqrtPower = a * x ** (-power0)
-		sqrtPower := bigMod(mulNew(a, num), s.n)
-		// if we find power1 such that
-		// sqrtPower == x ** (power1 * sqrtR)
-		// then the answer is power1 * sqrtR + power0
-		sqrtPowerIndex := sort.Search(len(s.xSqrtPowers), func(idx int) bool {
-			return s.xSqrtPowers[idx].num.Cmp(sqrtPower) >= 0
-		})
-		if sqrtPowerIndex < len(s.xSqrtPowers) {
-			if s.xSqrtPowers[sqrtPowerIndex].num.Cmp(sqrtPower) == 0 {
-				// take mod r since it might overflow
-				return nIntSetUint64((s.xSqrtPowers[sqrtPowerIndex].power + uint64(power)) % s.r)
-			}
-		}
+	m, err := s.DecryptE(c)
+	if err != nil {
+		panic("Unable to Decrypt a Benaloh Ciphertext, was the ciphertext correct?")
+	}
+	return m
+}
+
+// DecryptSigned decrypts a ciphertext in the same way as DecryptE and
+// maps the plaintexts from r / 2 on to the negative values m - r
+//
+// It returns ErrOverflow if the plaintext falls into the guard band of
+// the key, see WithGuardBand
+func (s SecretBenaloh) DecryptSigned(c *Ciphertext) (*big.Int, error) {
+	m, err := s.DecryptE(c)
+	if err != nil {
+		return nil, err
+	}
+	return signedPlaintext(m, s.r, s.guard)
+}
+
+// DecryptInt64 decrypts a ciphertext in the same way as DecryptSigned and
+// returns ErrOverflow if the plaintext doesn't fit in an int64
+func (s SecretBenaloh) DecryptInt64(c *Ciphertext) (int64, error) {
+	return plaintextInt64(s.DecryptSigned(c))
+}
+
+// WithGuardBand returns a copy of the key whose DecryptSigned rejects
+// the `width` plaintexts around r / 2, see signedPlaintext
+//
+// It returns ErrInvalidKey if width is negative or not smaller than r
+func (s SecretBenaloh) WithGuardBand(width *big.Int) (SecretBenaloh, error) {
+	if err := checkGuardBand(width, s.r); err != nil {
+		return SecretBenaloh{}, err
+	}
+	s.guard = copyInt(width)
+	return s, nil
+}
+
+// DecryptE decrypts a ciphertext in the same way as Decrypt but returns
+// ErrInvalidCiphertext if c is not in (0, n) and ErrDecryptionFailed
+// if there is no m such that x ** m = c ** ((p - 1) / r) mod p
+func (s SecretBenaloh) DecryptE(c *Ciphertext) (*big.Int, error) {
+	if c == nil || c.num == nil || c.num.Sign() <= 0 || c.num.Cmp(s.n) >= 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	// a = c ** ((p - 1) / r) mod p
+	a := s.pCtxs.exp(c.num, s.pOverR, s.p.BitLen())
+	m, ok := s.discreteLog(a)
+	if !ok {
+		return nil, ErrDecryptionFailed
 	}
-	panic("Unable to Decrypt a Benaloh Ciphertext, was the ciphertext correct?")
+	return m, nil
 }
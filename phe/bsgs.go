@@ -0,0 +1,220 @@
+package phe
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"math/bits"
+	"sort"
+)
+
+// discreteLogTable finds discrete logarithms to a fixed base
+type discreteLogTable interface {
+	// log returns e in [0, order) such that g ** e = h mod m, ok is false
+	// if there is no such e
+	log(h *big.Int) (e uint64, ok bool)
+}
+
+// bsgsStep returns ceil(sqrt(order))
+func bsgsStep(order uint64) uint64 {
+	step := uint64(math.Ceil(math.Sqrt(float64(order))))
+	// the float might be off by one either way
+	for step > 1 && (step-1)*(step-1) >= order {
+		step--
+	}
+	for step < 1<<32 && step*step < order {
+		step++
+	}
+	return step
+}
+
+// bsgsTable finds discrete logarithms to a base g of order `order`
+// modulo m with the meet-in-the-middle (baby-step giant-step) approach
+//
+// It indexes g ** (j * step) for j < step = ceil(sqrt(order)) so every
+// logarithm is i + j * step for the first i such that h * g ** (-i) is in
+// the index. The index is an open addressing hash table which only keeps
+// a 64 bit fingerprint of every giant step and its j, 16 bytes per slot
+// with at most half of the slots used, instead of the values themselves.
+// A fingerprint can match another value so every hit is verified by
+// computing g ** e
+//
+// The slots are kept as little endian bytes, the same layout as in the
+// files written by SecretBenaloh.WriteTables, so a table can be read
+// straight from a mapped file
+type bsgsTable struct {
+	order uint64
+	step  uint64
+	mod   *big.Int
+	g     *big.Int
+	gInv  *big.Int
+	// slots holds a power of two number of slots,
+	// shift = 64 - log2(number of slots)
+	slots []byte
+	shift uint
+}
+
+// A slot is the fingerprint of g ** ((j - 1) * step) followed by j, or
+// zero for an empty slot
+const bsgsSlotSize = 16
+
+// bsgsSlots returns the number of slots of the table for `order`, the
+// smallest power of two not smaller than 2 * step
+func bsgsSlots(order uint64) uint64 {
+	return 1 << bits.Len64(2*bsgsStep(order)-1)
+}
+
+func newBSGSTable(g *big.Int, order uint64, mod *big.Int) *bsgsTable {
+	step := bsgsStep(order)
+	t := bsgsTableFromSlots(g, order, mod, make([]byte, bsgsSlots(order)*bsgsSlotSize))
+	// g ** step mod m
+	gStep := powMod(g, nIntSetUint64(step), mod)
+	giant := nIntSetUint64(1)
+	prod := nInt()
+	for j := uint64(0); j < step; j++ {
+		t.insert(fingerprint(giant), j+1)
+		giant.Mod(prod.Mul(giant, gStep), mod)
+	}
+	return t
+}
+
+// bsgsTableFromSlots returns a table over slots already filled, or to be
+// filled, by the caller
+func bsgsTableFromSlots(g *big.Int, order uint64, mod *big.Int, slots []byte) *bsgsTable {
+	return &bsgsTable{
+		order: order,
+		step:  bsgsStep(order),
+		mod:   mod,
+		g:     copyInt(g),
+		gInv:  invMod(g, mod),
+		slots: slots,
+		shift: uint(64 - bits.Len64(uint64(len(slots)/bsgsSlotSize)-1)),
+	}
+}
+
+// fingerprint returns the lowest 64 bits of x, which are as good as
+// random for the powers of g
+func fingerprint(x *big.Int) (fp uint64) {
+	for i, w := range x.Bits() {
+		if i*bits.UintSize >= 64 {
+			break
+		}
+		fp |= uint64(w) << (i * bits.UintSize)
+	}
+	return
+}
+
+// home returns the first slot to probe for fp
+func (t *bsgsTable) home(fp uint64) uint64 {
+	// Fibonacci hashing spreads the fingerprints that only differ
+	// in their high bits
+	return (fp * 0x9e3779b97f4a7c15) >> t.shift
+}
+
+func (t *bsgsTable) slot(i uint64) (fp, j uint64) {
+	s := t.slots[i*bsgsSlotSize : (i+1)*bsgsSlotSize]
+	return binary.LittleEndian.Uint64(s), binary.LittleEndian.Uint64(s[8:])
+}
+
+func (t *bsgsTable) insert(fp, j uint64) {
+	mask := uint64(len(t.slots)/bsgsSlotSize - 1)
+	i := t.home(fp)
+	for _, used := t.slot(i); used != 0; _, used = t.slot(i) {
+		i = (i + 1) & mask
+	}
+	binary.LittleEndian.PutUint64(t.slots[i*bsgsSlotSize:], fp)
+	binary.LittleEndian.PutUint64(t.slots[i*bsgsSlotSize+8:], j)
+}
+
+func (t *bsgsTable) log(h *big.Int) (e uint64, ok bool) {
+	mask := uint64(len(t.slots)/bsgsSlotSize - 1)
+	// baby = h * g ** (-i)
+	baby := copyInt(h)
+	prod := nInt()
+	for i := uint64(0); i < t.step; i++ {
+		fp := fingerprint(baby)
+		// the probes stop at an empty slot, or after the whole table for
+		// the slots of a modified file that are all used
+		for s, n := t.home(fp), uint64(0); n <= mask; s, n = (s+1)&mask, n+1 {
+			sfp, j := t.slot(s)
+			if j == 0 {
+				break
+			}
+			if sfp != fp {
+				continue
+			}
+			// take mod order since it might overflow
+			e = ((j-1)*t.step + i) % t.order
+			if powMod(t.g, nIntSetUint64(e), t.mod).Cmp(h) == 0 {
+				return e, true
+			}
+		}
+		baby.Mod(prod.Mul(baby, t.gInv), t.mod)
+	}
+	return 0, false
+}
+
+type rootPower struct {
+	power uint64
+	num   *big.Int
+}
+
+// sortedBSGSTable is the previous discreteLogTable which keeps every
+// g ** (-i) and g ** (j * step) as a big.Int and binary searches the giant
+// steps sorted by value. It takes six times the memory of a bsgsTable for
+// 512 bit moduli and is only kept to check the latter in the tests
+type sortedBSGSTable struct {
+	order     uint64
+	step      uint64
+	mod       *big.Int
+	invPowers []*big.Int
+	// giant is sorted by num so it can be binary searched
+	giant []rootPower
+}
+
+func newSortedBSGSTable(g *big.Int, order uint64, mod *big.Int) *sortedBSGSTable {
+	step := bsgsStep(order)
+	t := &sortedBSGSTable{
+		order:     order,
+		step:      step,
+		mod:       mod,
+		invPowers: make([]*big.Int, step, step),
+		giant:     make([]rootPower, step, step),
+	}
+	// g ** (-1) mod m
+	gInv := invMod(g, mod)
+	// g ** step mod m
+	gStep := powMod(g, nIntSetUint64(step), mod)
+
+	t.invPowers[0] = nIntSetUint64(1)
+	t.giant[0] = rootPower{power: 0, num: nIntSetUint64(1)}
+	for i := uint64(1); i < step; i++ {
+		// g ** (-i) mod m
+		t.invPowers[i] = bigMod(mulNew(gInv, t.invPowers[i-1]), mod)
+		// g ** (i * step) mod m
+		t.giant[i] = rootPower{power: i * step, num: bigMod(mulNew(gStep, t.giant[i-1].num), mod)}
+	}
+
+	sort.Slice(t.giant, func(i, j int) bool {
+		return t.giant[i].num.Cmp(t.giant[j].num) < 0
+	})
+	return t
+}
+
+func (t *sortedBSGSTable) log(h *big.Int) (e uint64, ok bool) {
+	for power, num := range t.invPowers {
+		// giant = h * g ** (-power0)
+		giant := bigMod(mulNew(h, num), t.mod)
+		// if we find power1 such that
+		// giant == g ** (power1 * step)
+		// then the answer is power1 * step + power0
+		idx := sort.Search(len(t.giant), func(idx int) bool {
+			return t.giant[idx].num.Cmp(giant) >= 0
+		})
+		if idx < len(t.giant) && t.giant[idx].num.Cmp(giant) == 0 {
+			// take mod order since it might overflow
+			return (t.giant[idx].power + uint64(power)) % t.order, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,135 @@
+package phe
+
+import (
+	pRand "github.com/reality95/cryptosystem/rand"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"runtime"
+	"testing"
+)
+
+// getSubgroup returns a prime p and an element of order `order` mod p
+func getSubgroup(order uint64, bits int) (g, p *big.Int) {
+	p, _ = pRand.Prime(rnd, bits, nIntSetUint64(order))
+	cofactor := divNew(subNew(p, oneInt), nIntSetUint64(order))
+	for g == nil || g.Cmp(oneInt) == 0 {
+		g = powMod(nInt().Rand(rnd, p), cofactor, p)
+	}
+	return
+}
+
+// nextPrime returns the smallest prime not smaller than x
+func nextPrime(x uint64) uint64 {
+	for !isProbablePrime(x) {
+		x++
+	}
+	return x
+}
+
+func TestBSGSTable(t *testing.T) {
+	assert := assert.New(t)
+	for _, order := range []uint64{2, 3, 5, 1009, 65537, nextPrime(1 << 24)} {
+		g, p := getSubgroup(order, 256)
+		hashed := newBSGSTable(g, order, p)
+		sorted := newSortedBSGSTable(g, order, p)
+		for i := 0; i < 16; i++ {
+			e := rnd.Uint64() % order
+			h := powMod(g, nIntSetUint64(e), p)
+			got, ok := hashed.log(h)
+			assert.True(ok)
+			assert.Equal(e, got)
+			got, ok = sorted.log(h)
+			assert.True(ok)
+			assert.Equal(e, got)
+		}
+		// 2 would need 2 ** order = 1 mod p to be a power of g
+		assert.NotEqual(oneInt, powMod(nIntSetUint64(2), nIntSetUint64(order), p))
+		_, ok := hashed.log(nIntSetUint64(2))
+		assert.False(ok, "Expected no logarithm outside of the subgroup")
+		_, ok = sorted.log(nIntSetUint64(2))
+		assert.False(ok, "Expected no logarithm outside of the subgroup")
+	}
+}
+
+func TestBSGSFingerprintCollision(t *testing.T) {
+	assert := assert.New(t)
+	order := uint64(1000003)
+	g, p := getSubgroup(order, 256)
+	table := newBSGSTable(g, order, p)
+	e := uint64(123456)
+	i, j := e%table.step, e/table.step
+	// put a slot with the fingerprint of g ** (j * step) but another j in
+	// front of the right one so the lookup has to verify it and go on
+	giant := powMod(g, nIntSetUint64(j*table.step), p)
+	old := bsgsTableFromSlots(g, order, p, table.slots)
+	table.slots = make([]byte, len(old.slots))
+	table.insert(fingerprint(giant), j+2)
+	for k := uint64(0); k < uint64(len(old.slots)/bsgsSlotSize); k++ {
+		if fp, j := old.slot(k); j != 0 {
+			table.insert(fp, j)
+		}
+	}
+	got, ok := table.log(powMod(g, nIntSetUint64(e), p))
+	assert.True(ok)
+	assert.Equal(i+j*table.step, got)
+}
+
+// withSortedTables returns a copy of s that decrypts with sortedBSGSTable
+func withSortedTables(s SecretBenaloh) SecretBenaloh {
+	s = CopySecretBenaloh(s)
+	// the factors are shared with s
+	s.factors = append([]benalohFactor(nil), s.factors...)
+	for i := range s.factors {
+		f := &s.factors[i]
+		f.table = newSortedBSGSTable(f.base, f.prime, s.p)
+	}
+	return s
+}
+
+func TestSortedTables(t *testing.T) {
+	p, s := GenNewKeysBenaloh(1000003, 512)
+	sorted := withSortedTables(s)
+	for i := 0; i < 16; i++ {
+		m := rnd.Uint64() % 1000003
+		assert.Equal(t, m, sorted.Decrypt(p.EncryptUint64(m)).Uint64())
+	}
+}
+
+// heapBytes returns the live heap after a garbage collection
+func heapBytes() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+func BenchmarkBSGSTable(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		order uint64
+	}{{"2^32", nextPrime(1 << 32)}, {"2^40", nextPrime(1 << 40)}} {
+		g, p := getSubgroup(bench.order, 512)
+		hs := make([]*big.Int, 16)
+		for i := range hs {
+			hs[i] = powMod(g, nIntSetUint64(rnd.Uint64()%bench.order), p)
+		}
+		for _, kind := range []struct {
+			name string
+			new  func() discreteLogTable
+		}{
+			{"Hashed", func() discreteLogTable { return newBSGSTable(g, bench.order, p) }},
+			{"Sorted", func() discreteLogTable { return newSortedBSGSTable(g, bench.order, p) }},
+		} {
+			b.Run(bench.name+"/"+kind.name, func(b *testing.B) {
+				before := heapBytes()
+				table := kind.new()
+				size := heapBytes() - before
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					table.log(hs[i%len(hs)])
+				}
+				b.ReportMetric(float64(size), "table-B")
+			})
+		}
+	}
+}
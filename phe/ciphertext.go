@@ -0,0 +1,288 @@
+package phe
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+type scheme byte
+
+const (
+	schemePaillier scheme = iota + 1
+	schemeBenaloh
+)
+
+var schemeNames = map[scheme]string{
+	schemePaillier: "paillier",
+	schemeBenaloh:  "benaloh",
+}
+
+func (s scheme) String() string {
+	if name, ok := schemeNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("scheme(%d)", byte(s))
+}
+
+func parseScheme(name string) (scheme, bool) {
+	for s, n := range schemeNames {
+		if n == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// binding ties a ciphertext to the scheme and to the fingerprint of
+// the public key that produced it
+type binding struct {
+	scheme scheme
+	key    [sha256.Size]byte
+}
+
+// newBinding computes the SHA-256 fingerprint of the binary
+// encoding of the public key
+func newBinding(s scheme, p encoding.BinaryMarshaler) binding {
+	data, _ := p.MarshalBinary()
+	return binding{scheme: s, key: sha256.Sum256(data)}
+}
+
+// The ciphertexts are encoded as
+//
+//	version (1 byte) | scheme (1 byte) | key fingerprint (32 bytes) | value
+//
+// where value is the minimal big endian encoding of the ciphertext
+
+const ciphertextEncodingVersion = 1
+
+const ciphertextHeaderSize = 2 + sha256.Size
+
+// MarshalBinary encodes the ciphertext together with the scheme and
+// the fingerprint of the public key that produced it
+//
+// It returns ErrInvalidCiphertext for a zero Ciphertext
+func (c *Ciphertext) MarshalBinary() ([]byte, error) {
+	if err := c.checkSet(); err != nil {
+		return nil, err
+	}
+	value := c.num.Bytes()
+	data := make([]byte, ciphertextHeaderSize, ciphertextHeaderSize+len(value))
+	data[0] = ciphertextEncodingVersion
+	data[1] = byte(c.bind.scheme)
+	copy(data[2:], c.bind.key[:])
+	return append(data, value...), nil
+}
+
+// checkSet reports ErrInvalidCiphertext for a nil or zero Ciphertext,
+// which no key produced
+func (c *Ciphertext) checkSet() error {
+	if c == nil || c.num == nil {
+		return fmt.Errorf("%w: zero ciphertext", ErrInvalidCiphertext)
+	}
+	return nil
+}
+
+// UnmarshalBinary decodes a ciphertext encoded by MarshalBinary
+//
+// It doesn't check that the ciphertext belongs to any particular key,
+// UnmarshalCiphertext should be used for that
+func (c *Ciphertext) UnmarshalBinary(data []byte) error {
+	if len(data) < ciphertextHeaderSize {
+		return fmt.Errorf("%w: too short", ErrInvalidCiphertext)
+	}
+	if data[0] != ciphertextEncodingVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidCiphertext, data[0])
+	}
+	if _, ok := schemeNames[scheme(data[1])]; !ok {
+		return fmt.Errorf("%w: unknown scheme %d", ErrInvalidCiphertext, data[1])
+	}
+	value := data[ciphertextHeaderSize:]
+	if len(value) > 0 && value[0] == 0 {
+		return fmt.Errorf("%w: non-minimal value", ErrInvalidCiphertext)
+	}
+	c.bind.scheme = scheme(data[1])
+	copy(c.bind.key[:], data[2:ciphertextHeaderSize])
+	c.num = nInt().SetBytes(value)
+	return nil
+}
+
+type ciphertextJSON struct {
+	Scheme string `json:"scheme"`
+	Key    string `json:"key"`
+	Value  []byte `json:"value"`
+}
+
+// MarshalJSON encodes the ciphertext as a JSON object holding the scheme,
+// the hex encoded fingerprint of the public key and the base64 encoded
+// big endian value
+//
+// It returns ErrInvalidCiphertext for a zero Ciphertext
+func (c *Ciphertext) MarshalJSON() ([]byte, error) {
+	if err := c.checkSet(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ciphertextJSON{
+		Scheme: c.bind.scheme.String(),
+		Key:    hex.EncodeToString(c.bind.key[:]),
+		Value:  c.num.Bytes(),
+	})
+}
+
+// UnmarshalJSON decodes a ciphertext encoded by MarshalJSON
+//
+// Like UnmarshalBinary it doesn't check the key,
+// UnmarshalCiphertextJSON should be used for that
+func (c *Ciphertext) UnmarshalJSON(data []byte) error {
+	var v ciphertextJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCiphertext, err)
+	}
+	s, ok := parseScheme(v.Scheme)
+	if !ok {
+		return fmt.Errorf("%w: unknown scheme %q", ErrInvalidCiphertext, v.Scheme)
+	}
+	key, err := hex.DecodeString(v.Key)
+	if err != nil || len(key) != sha256.Size {
+		return fmt.Errorf("%w: malformed key fingerprint", ErrInvalidCiphertext)
+	}
+	c.bind.scheme = s
+	copy(c.bind.key[:], key)
+	c.num = nInt().SetBytes(v.Value)
+	return nil
+}
+
+// UnmarshalCiphertext decodes a ciphertext encoded by MarshalBinary
+// and returns ErrKeyMismatch if it wasn't produced by p or
+// ErrInvalidCiphertext if it doesn't pass p.Validate
+func UnmarshalCiphertext(p PublicKey, data []byte) (*Ciphertext, error) {
+	c := &Ciphertext{}
+	if err := c.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if err := checkBinding(p, c); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UnmarshalCiphertextJSON decodes a ciphertext encoded by MarshalJSON
+// and returns ErrKeyMismatch if it wasn't produced by p or
+// ErrInvalidCiphertext if it doesn't pass p.Validate
+func UnmarshalCiphertextJSON(p PublicKey, data []byte) (*Ciphertext, error) {
+	c := &Ciphertext{}
+	if err := c.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	if err := checkBinding(p, c); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validateCiphertext checks that 0 < c < bound and gcd(c, n) = 1
+func validateCiphertext(c *Ciphertext, bound, n *big.Int) error {
+	if err := checkRange(c, bound); err != nil {
+		return err
+	}
+	if nInt().GCD(nil, nil, c.num, n).Cmp(oneInt) != 0 {
+		return fmt.Errorf("%w: not coprime with n", ErrInvalidCiphertext)
+	}
+	return nil
+}
+
+func checkRange(c *Ciphertext, bound *big.Int) error {
+	if c == nil || c.num == nil {
+		return ErrInvalidCiphertext
+	}
+	if c.num.Sign() <= 0 || c.num.Cmp(bound) >= 0 {
+		return fmt.Errorf("%w: out of range", ErrInvalidCiphertext)
+	}
+	return nil
+}
+
+// ValidateVector checks every ciphertext of v in the same way as
+// p.Validate and reports the index of the first invalid one
+//
+// All the ciphertexts are coprime with n if and only if their product is,
+// so only one gcd is computed for the whole vector
+func ValidateVector(p PublicKey, v []*Ciphertext) error {
+	k, ok := p.(boundKey)
+	if !ok {
+		for i, c := range v {
+			if err := p.Validate(c); err != nil {
+				return fmt.Errorf("ciphertext %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+	bound, n := k.validationModuli()
+	prod := nIntSetUint64(1)
+	for i, c := range v {
+		if err := checkRange(c, bound); err != nil {
+			return fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+		bigMod(prod.Mul(prod, c.num), n)
+	}
+	if nInt().GCD(nil, nil, prod, n).Cmp(oneInt) == 0 {
+		return nil
+	}
+	// Rare enough to look for the culprit one by one
+	for i, c := range v {
+		if err := validateCiphertext(c, bound, n); err != nil {
+			return fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkOperands checks that every ciphertext given to an operation
+// of p was produced by p
+func checkOperands(p PublicKey, cs ...*Ciphertext) error {
+	for _, c := range cs {
+		if c == nil || c.num == nil {
+			return ErrInvalidCiphertext
+		}
+		if err := checkBinding(p, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invertCiphertext returns c ** (-1) mod m, which encrypts the opposite
+// of the plaintext of c, or ErrInvalidCiphertext if c isn't invertible
+func invertCiphertext(c *Ciphertext, m *big.Int) (*big.Int, error) {
+	inv := invMod(c.num, m)
+	if inv == nil {
+		return nil, fmt.Errorf("%w: not invertible", ErrInvalidCiphertext)
+	}
+	return inv, nil
+}
+
+func checkBinding(p PublicKey, c *Ciphertext) error {
+	k, ok := p.(boundKey)
+	if !ok {
+		if c.bind.key != p.Fingerprint() {
+			return fmt.Errorf("%w: the key fingerprints differ", ErrKeyMismatch)
+		}
+		return nil
+	}
+	want := k.keyBinding()
+	if c.bind.scheme != want.scheme {
+		return fmt.Errorf("%w: %v ciphertext for a %v key", ErrKeyMismatch, c.bind.scheme, want.scheme)
+	}
+	if c.bind.key != want.key {
+		return fmt.Errorf("%w: the key fingerprints differ", ErrKeyMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package phe
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// montWindow is the number of exponent bits handled per multiplication
+const montWindow = 4
+
+// montModulus is an odd modulus m of n words prepared for Montgomery
+// multiplication with R = 2 ** (n * bits.UintSize)
+//
+// Every value is kept in exactly n words and the operations below touch
+// every word and take the same branches whatever the values are, so
+// their running time only depends on the size of m and of the exponent
+type montModulus struct {
+	mBig  *big.Int
+	m     []uint
+	m0inv uint   // -m ** (-1) mod 2 ** bits.UintSize
+	one   []uint // R mod m
+	rr    []uint // R ** 2 mod m
+}
+
+func newMontModulus(m *big.Int) *montModulus {
+	n := len(m.Bits())
+	mm := &montModulus{mBig: m, m: wordsOf(m, n)}
+	// Newton's iteration doubles the number of correct low bits of the
+	// inverse and m0 * m0 = 1 mod 8 gives the first 3 of them
+	m0 := mm.m[0]
+	inv := m0
+	for i := 0; i < 5; i++ {
+		inv *= 2 - m0*inv
+	}
+	mm.m0inv = -inv
+	r := bigMod(nInt().Lsh(oneInt, uint(n*bits.UintSize)), m)
+	mm.one = wordsOf(r, n)
+	mm.rr = wordsOf(bigMod(mulNew(r, r), m), n)
+	return mm
+}
+
+// wordsOf returns the n lowest words of x
+func wordsOf(x *big.Int, n int) []uint {
+	z := make([]uint, n)
+	for i, w := range x.Bits() {
+		z[i] = uint(w)
+	}
+	return z
+}
+
+func intOfWords(x []uint) *big.Int {
+	w := make([]big.Word, len(x))
+	for i, v := range x {
+		w[i] = big.Word(v)
+	}
+	return nInt().SetBits(w)
+}
+
+// mulAddWWW returns the two words of a * b + c + d
+func mulAddWWW(a, b, c, d uint) (hi, lo uint) {
+	hi, lo = bits.Mul(a, b)
+	var carry uint
+	lo, carry = bits.Add(lo, c, 0)
+	hi += carry
+	lo, carry = bits.Add(lo, d, 0)
+	hi += carry
+	return
+}
+
+// mul sets z = x * y * R ** (-1) mod m using the scratch space t of
+// n + 2 words. x and y must be smaller than m, z may alias them
+func (mm *montModulus) mul(z, x, y, t []uint) {
+	n := len(mm.m)
+	for i := range t {
+		t[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		// t = t + x * y[i]
+		var c, carry uint
+		for j := 0; j < n; j++ {
+			c, t[j] = mulAddWWW(x[j], y[i], t[j], c)
+		}
+		t[n], carry = bits.Add(t[n], c, 0)
+		t[n+1] = carry
+		// t = (t + q * m) / 2 ** bits.UintSize where q makes it divisible
+		q := t[0] * mm.m0inv
+		c, _ = mulAddWWW(q, mm.m[0], t[0], 0)
+		for j := 1; j < n; j++ {
+			c, t[j-1] = mulAddWWW(q, mm.m[j], t[j], c)
+		}
+		t[n-1], carry = bits.Add(t[n], c, 0)
+		t[n] = t[n+1] + carry
+	}
+	// t < 2 * m so at most one subtraction of m is needed, it is always
+	// computed and the result is selected with a mask
+	var borrow uint
+	for j := 0; j < n; j++ {
+		t[n+1], borrow = bits.Sub(t[j], mm.m[j], borrow)
+		z[j] = t[n+1]
+	}
+	// keep z = t - m when t[n] is set or the subtraction didn't borrow
+	mask := -(t[n] | (borrow ^ 1))
+	for j := 0; j < n; j++ {
+		z[j] = (z[j] & mask) | (t[j] &^ mask)
+	}
+}
+
+// ctEqMask returns all ones if a == b and zero otherwise
+func ctEqMask(a, b uint) uint {
+	x := a ^ b
+	return ((x | -x) >> (bits.UintSize - 1)) - 1
+}
+
+// ctSelect sets z = table[idx] reading every entry of the table
+func ctSelect(z []uint, table [][]uint, idx uint) {
+	for j := range z {
+		z[j] = 0
+	}
+	for k, entry := range table {
+		mask := ctEqMask(uint(k), idx)
+		for j := range z {
+			z[j] |= entry[j] & mask
+		}
+	}
+}
+
+// exp returns x ** e mod m going through all the `width` lowest bits of
+// e, see ModContext.exp
+func (mm *montModulus) exp(x, e *big.Int, width int, trace *[]byte) *big.Int {
+	return newModContext(mm).exp(nInt(), x, e, width, trace)
+}
+
+// powModSecret returns a ** e mod m for a secret exponent e smaller than
+// 2 ** width in a time that doesn't depend on e
+//
+// m must be odd, which is the case for every modulus of the keys
+func powModSecret(a, e, mod *big.Int, width int) *big.Int {
+	return newMontModulus(mod).exp(a, e, width, nil)
+}
+
+// fixedBaseTable holds base ** (j * 16 ** i) mod m in Montgomery form for
+// every window i of an exponent of at most `width` bits and every digit j
+//
+// An exponentiation of the fixed base then costs one multiplication per
+// window and no squaring. The table is never modified once it is built,
+// so the copies of a key share it and read it from any number of go
+// routines
+type fixedBaseTable struct {
+	mm      *montModulus
+	width   int
+	windows [][][]uint
+}
+
+func newFixedBaseTable(base, mod *big.Int, width int) *fixedBaseTable {
+	mm := newMontModulus(mod)
+	n := len(mm.m)
+	t := make([]uint, n+2)
+	windows := make([][][]uint, (width+montWindow-1)/montWindow)
+	// b = base ** (16 ** i) in Montgomery form
+	b := wordsOf(nInt().Mod(base, mod), n)
+	mm.mul(b, b, mm.rr, t)
+	for i := range windows {
+		digits := make([][]uint, 1<<montWindow)
+		digits[0] = append([]uint(nil), mm.one...)
+		for j := 1; j < len(digits); j++ {
+			digits[j] = make([]uint, n)
+			mm.mul(digits[j], digits[j-1], b, t)
+		}
+		windows[i] = digits
+		mm.mul(b, digits[len(digits)-1], b, t)
+	}
+	return &fixedBaseTable{mm: mm, width: width, windows: windows}
+}
+
+// exp returns base ** e mod m for an exponent e smaller than 2 ** width
+// in a time that doesn't depend on e
+func (f *fixedBaseTable) exp(e *big.Int) *big.Int {
+	mm := f.mm
+	n := len(mm.m)
+	ew := wordsOf(e, (len(f.windows)*montWindow+bits.UintSize-1)/bits.UintSize)
+	t := make([]uint, n+2)
+	acc := append([]uint(nil), mm.one...)
+	sel := make([]uint, n)
+	for i, digits := range f.windows {
+		idx := i * montWindow
+		ctSelect(sel, digits, (ew[idx/bits.UintSize]>>(idx%bits.UintSize))&(1<<montWindow-1))
+		mm.mul(acc, acc, sel, t)
+	}
+	unit := make([]uint, n)
+	unit[0] = 1
+	mm.mul(acc, acc, unit, t)
+	return intOfWords(acc)
+}
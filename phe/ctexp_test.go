@@ -0,0 +1,55 @@
+package phe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestPowModSecret(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysPaillier(512)
+	for _, mod := range []*big.Int{nIntSetUint64(1000000007), nIntSetUint64(1<<63 + 25), p.n, p.n2} {
+		for i := 0; i < 16; i++ {
+			a := nInt().Rand(rnd, mulNew(mod, nIntSetUint64(2)))
+			e := nInt().Rand(rnd, mod)
+			assert.Equal(nInt().Exp(a, e, mod), powModSecret(a, e, mod, mod.BitLen()))
+		}
+		assert.Equal(oneInt, powModSecret(nIntSetUint64(2), zeroInt, mod, 64))
+		assert.Equal(nInt().Exp(nIntSetUint64(3), nIntSetUint64(1<<64-1), mod), powModSecret(nIntSetUint64(3), nIntSetUint64(1<<64-1), mod, 64))
+	}
+	// the width is only a lower bound
+	assert.Equal(nInt().Exp(nIntSetUint64(3), s.lambda, p.n2), powModSecret(nIntSetUint64(3), s.lambda, p.n2, 8))
+}
+
+func TestPowModSecretTrace(t *testing.T) {
+	_, s := GenNewKeysPaillier(512)
+	mm := newMontModulus(s.n2)
+	width := s.n.BitLen()
+	all := nInt().Sub(nInt().Lsh(oneInt, uint(width)), oneInt)
+	var want []byte
+	mm.exp(nIntSetUint64(69), s.lambda, width, &want)
+	for _, e := range []*big.Int{zeroInt, oneInt, all, s.phi, nInt().Rand(rnd, s.n)} {
+		var trace []byte
+		mm.exp(nIntSetUint64(69), e, width, &trace)
+		assert.Equal(t, want, trace, "Expected the same operations for every exponent")
+	}
+}
+
+func BenchmarkPowModSecret(b *testing.B) {
+	_, s := GenNewKeysPaillier(1024)
+	c := nInt().Rand(rnd, s.n2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		powModSecret(c, s.lambda, s.n2, s.n.BitLen())
+	}
+}
+
+func BenchmarkPowMod(b *testing.B) {
+	_, s := GenNewKeysPaillier(1024)
+	c := nInt().Rand(rnd, s.n2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		powMod(c, s.lambda, s.n2)
+	}
+}
@@ -45,6 +45,11 @@
 // cryptosystem impractical for many applications but ideal for small scale
 // operations
 //
+// GenNewKeysBenalohComposite takes r as a list of prime powers instead, the
+// decryption then only needs O(l ** 0.5) memory per prime l of r so a smooth
+// r such as 2 ** 64 is practical. The decryption tables can also be saved
+// with WriteTables and opened with OpenTableFile
+//
 // For Vector encryption EncryptVectorUint64 and EncryptVectorUint64Parallel
 // should be used.
 //
@@ -55,5 +60,17 @@
 // interface and SecretKey interface respectively
 //
 // It is necessary to copy the keys using Copy function if you're planning
-// using the key over multiple go routines
+// using the key over multiple go routines. The public keys and SecretBenaloh
+// are the exception, they can be used by several go routines at once
+//
+// The key generation, encryption and decryption have variants such as
+// GenerateKeysPaillier, EncryptUint64E and DecryptE that return one of the
+// Err* errors of the package instead of panicking or returning garbage
+//
+// The keys can be encoded with MarshalBinary, as PEM blocks or in the JSON
+// format of python-paillier
+//
+// Every ciphertext is bound to the public key that produced it, see
+// Fingerprint, and the ciphertexts received from untrusted parties should be
+// checked with Validate or ValidateVector
 package phe
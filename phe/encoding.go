@@ -0,0 +1,446 @@
+package phe
+
+import (
+	cRand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// The keys are encoded as
+//
+//	version (1 byte) | key type (1 byte) | field | field | ...
+//
+// where every field is a non-negative integer written as its length in
+// bytes (4 bytes, big endian) followed by its minimal big endian bytes.
+// The decoding rejects non-minimal integers and trailing bytes so every
+// key has exactly one encoding
+
+const keyEncodingVersion = 1
+
+// publicPaillierKeyVersion is the version of the public Paillier keys in
+// the short exponent mode, encoded as n, g, h and the length of the
+// exponents. The other public Paillier keys keep version 1 and n and g
+// so their fingerprints don't change
+const publicPaillierKeyVersion = 2
+
+type keyType byte
+
+const (
+	publicPaillierKey keyType = iota + 1
+	secretPaillierKey
+	publicBenalohKey
+	secretBenalohKey
+)
+
+type keyEncoder struct {
+	buf []byte
+}
+
+func newKeyEncoder(version byte, t keyType) *keyEncoder {
+	return &keyEncoder{buf: []byte{version, byte(t)}}
+}
+
+func (e *keyEncoder) int(x *big.Int) {
+	b := x.Bytes()
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+	e.buf = append(e.buf, l[:]...)
+	e.buf = append(e.buf, b...)
+}
+
+func (e *keyEncoder) bytes() []byte {
+	return e.buf
+}
+
+type keyDecoder struct {
+	buf     []byte
+	version byte
+	err     error
+}
+
+// newKeyDecoder accepts every version from 1 to maxVersion
+func newKeyDecoder(data []byte, t keyType, maxVersion byte) *keyDecoder {
+	d := &keyDecoder{}
+	if len(data) < 2 {
+		d.err = fmt.Errorf("%w: too short", ErrInvalidKey)
+		return d
+	}
+	if data[0] < 1 || data[0] > maxVersion {
+		d.err = fmt.Errorf("%w: unsupported version %d", ErrInvalidKey, data[0])
+		return d
+	}
+	if keyType(data[1]) != t {
+		d.err = fmt.Errorf("%w: unexpected key type %d", ErrInvalidKey, data[1])
+		return d
+	}
+	d.version = data[0]
+	d.buf = data[2:]
+	return d
+}
+
+func (d *keyDecoder) int() *big.Int {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < 4 {
+		d.err = fmt.Errorf("%w: truncated", ErrInvalidKey)
+		return nil
+	}
+	l := binary.BigEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	if uint64(len(d.buf)) < uint64(l) {
+		d.err = fmt.Errorf("%w: truncated", ErrInvalidKey)
+		return nil
+	}
+	if l > 0 && d.buf[0] == 0 {
+		d.err = fmt.Errorf("%w: non-minimal integer", ErrInvalidKey)
+		return nil
+	}
+	x := nInt().SetBytes(d.buf[:l])
+	d.buf = d.buf[l:]
+	return x
+}
+
+func (d *keyDecoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.err = fmt.Errorf("%w: trailing bytes", ErrInvalidKey)
+	}
+	return d.err
+}
+
+// unmarshalSecretKey decodes a secret key of any type
+// encoded by its MarshalBinary
+func unmarshalSecretKey(data []byte) (SecretKey, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidKey)
+	}
+	switch keyType(data[1]) {
+	case secretPaillierKey:
+		var s SecretPaillier
+		if err := s.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case secretBenalohKey:
+		var s SecretBenaloh
+		if err := s.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected key type %d", ErrInvalidKey, data[1])
+}
+
+// isUnit checks if 0 < x < mod and gcd(x, mod) = 1
+func isUnit(x, mod *big.Int) bool {
+	return x.Sign() > 0 && x.Cmp(mod) < 0 && nInt().GCD(nil, nil, x, mod).Cmp(oneInt) == 0
+}
+
+// MarshalBinary encodes the public key as n and g, followed by h and
+// the length of the exponents in the short exponent mode
+func (p PublicPaillier) MarshalBinary() ([]byte, error) {
+	if p.h == nil {
+		e := newKeyEncoder(keyEncodingVersion, publicPaillierKey)
+		e.int(p.n)
+		e.int(p.g)
+		return e.bytes(), nil
+	}
+	e := newKeyEncoder(publicPaillierKeyVersion, publicPaillierKey)
+	e.int(p.n)
+	e.int(p.g)
+	e.int(p.h)
+	e.int(nIntSetUint64(uint64(p.shortBits)))
+	return e.bytes(), nil
+}
+
+// UnmarshalBinary decodes a public key encoded by MarshalBinary
+//
+// The nonces of the decoded key are read from crypto/rand.Reader
+func (p *PublicPaillier) UnmarshalBinary(data []byte) error {
+	d := newKeyDecoder(data, publicPaillierKey, publicPaillierKeyVersion)
+	n, g := d.int(), d.int()
+	var h, bits *big.Int
+	if d.version == publicPaillierKeyVersion {
+		h, bits = d.int(), d.int()
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	var key PublicPaillier
+	var err error
+	if h == nil {
+		key, err = newPublicPaillier(n, g)
+	} else {
+		if !bits.IsInt64() || bits.Int64() > int64(n.BitLen()) {
+			return fmt.Errorf("%w: the exponent length must be at most %d", ErrInvalidKey, n.BitLen())
+		}
+		key, err = newShortPublicPaillier(n, g, h, int(bits.Int64()))
+	}
+	if err != nil {
+		return err
+	}
+	*p = key
+	return nil
+}
+
+// newPublicPaillier builds a public key from n and g computing
+// every derived value
+func newPublicPaillier(n, g *big.Int) (p PublicPaillier, err error) {
+	if n.Cmp(oneInt) <= 0 || n.Bit(0) == 0 {
+		err = fmt.Errorf("%w: n must be odd and greater than 1", ErrInvalidKey)
+		return
+	}
+	n2 := mulNew(n, n)
+	if !isUnit(g, n2) {
+		err = fmt.Errorf("%w: g is not invertible mod n ** 2", ErrInvalidKey)
+		return
+	}
+	p = PublicPaillier{
+		n:      n,
+		n2:     n2,
+		g:      g,
+		fastG:  g.Cmp(addNew(n, oneInt)) == 0,
+		random: cRand.Reader,
+		ctxs:   newModContextPool(n2),
+	}
+	p.bind = paillierBinding(n, g)
+	return
+}
+
+// newShortPublicPaillier builds a public key in the short exponent mode
+// from n, g, h and the length of the exponents
+func newShortPublicPaillier(n, g, h *big.Int, bits int) (p PublicPaillier, err error) {
+	if p, err = newPublicPaillier(n, g); err != nil {
+		return
+	}
+	if !isUnit(h, n) {
+		err = fmt.Errorf("%w: h is not invertible mod n", ErrInvalidKey)
+		return
+	}
+	// shorter exponents make the nonces easier to guess than n to factor
+	if min := shortExponentBits(n.BitLen()); bits < min || bits > n.BitLen() {
+		err = fmt.Errorf("%w: the exponent length must be in [%d, %d]", ErrInvalidKey, min, n.BitLen())
+		return
+	}
+	p.setShortExponent(h, bits)
+	return
+}
+
+// MarshalBinary encodes the secret key as n, g and the factors p > q of n
+func (s SecretPaillier) MarshalBinary() ([]byte, error) {
+	e := newKeyEncoder(keyEncodingVersion, secretPaillierKey)
+	e.int(s.n)
+	e.int(s.g)
+	e.int(s.p)
+	e.int(s.q)
+	return e.bytes(), nil
+}
+
+// UnmarshalBinary decodes a secret key encoded by MarshalBinary
+func (s *SecretPaillier) UnmarshalBinary(data []byte) error {
+	d := newKeyDecoder(data, secretPaillierKey, keyEncodingVersion)
+	n, g, p, q := d.int(), d.int(), d.int(), d.int()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if p.Cmp(q) <= 0 {
+		return fmt.Errorf("%w: p must be greater than q", ErrInvalidKey)
+	}
+	key, err := newSecretPaillier(p, q, g)
+	if err != nil {
+		return err
+	}
+	if key.n.Cmp(n) != 0 {
+		return fmt.Errorf("%w: p * q is not n", ErrInvalidKey)
+	}
+	*s = key
+	return nil
+}
+
+// newSecretPaillier builds a secret key from the factors p and q of n
+// and g computing every derived value
+func newSecretPaillier(p, q, g *big.Int) (s SecretPaillier, err error) {
+	if p.Cmp(oneInt) <= 0 || q.Cmp(oneInt) <= 0 || p.Cmp(q) == 0 {
+		err = fmt.Errorf("%w: p and q must be distinct and greater than 1", ErrInvalidKey)
+		return
+	}
+	if p.Cmp(q) < 0 {
+		p, q = q, p
+	}
+	n := mulNew(p, q)
+	n2 := mulNew(n, n)
+	if !isUnit(g, n2) {
+		err = fmt.Errorf("%w: g is not invertible mod n ** 2", ErrInvalidKey)
+		return
+	}
+	p_1 := subNew(p, oneInt)
+	q_1 := subNew(q, oneInt)
+	phi := mulNew(p_1, q_1)                               // (p - 1) * (q - 1)
+	lambda := divNew(phi, nInt().GCD(nil, nil, p_1, q_1)) // lcm(p - 1, q - 1)
+	// mu = L(g ** lambda) ** (-1) mod n
+	mu := invMod(divNew(subNew(powModSecret(g, lambda, n2, n.BitLen()), oneInt), n), n)
+	if mu == nil {
+		err = fmt.Errorf("%w: L(g ** lambda) is not invertible mod n", ErrInvalidKey)
+		return
+	}
+	s = SecretPaillier{
+		n:      n,
+		n2:     n2,
+		g:      g,
+		lambda: lambda,
+		phi:    phi,
+		mu:     mu,
+		p:      p,
+		q:      q,
+	}
+	if !s.precompute() {
+		err = fmt.Errorf("%w: the CRT values don't exist", ErrInvalidKey)
+		return
+	}
+	s.bind = paillierBinding(n, g)
+	return
+}
+
+// MarshalBinary encodes the public key as n, y and r
+func (p PublicBenaloh) MarshalBinary() ([]byte, error) {
+	e := newKeyEncoder(keyEncodingVersion, publicBenalohKey)
+	e.int(p.n)
+	e.int(p.y)
+	e.int(p.r)
+	return e.bytes(), nil
+}
+
+// UnmarshalBinary decodes a public key encoded by MarshalBinary
+//
+// The nonces of the decoded key are read from crypto/rand.Reader
+func (p *PublicBenaloh) UnmarshalBinary(data []byte) error {
+	d := newKeyDecoder(data, publicBenalohKey, keyEncodingVersion)
+	n, y, r := d.int(), d.int(), d.int()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if err := checkBenalohParams(n, y, r); err != nil {
+		return err
+	}
+	*p = PublicBenaloh{
+		y:      y,
+		yInv:   invMod(y, n),
+		n:      n,
+		r:      r,
+		random: cRand.Reader,
+		ctxs:   newModContextPool(n),
+	}
+	p.bind = newBinding(schemeBenaloh, p)
+	return nil
+}
+
+// MarshalBinary encodes the secret key as n, y, r, phi and the
+// factorization of r as the number of factors followed by every prime
+// and its exponent
+//
+// The decryption tables are not encoded, they are computed again
+// by UnmarshalBinary
+func (s SecretBenaloh) MarshalBinary() ([]byte, error) {
+	e := newKeyEncoder(keyEncodingVersion, secretBenalohKey)
+	e.int(s.n)
+	e.int(s.y)
+	e.int(s.r)
+	e.int(s.phi)
+	e.int(nIntSetUint64(uint64(len(s.factors))))
+	for _, f := range s.primePowers() {
+		e.int(nIntSetUint64(f.Prime))
+		e.int(nIntSetUint64(uint64(f.Exp)))
+	}
+	return e.bytes(), nil
+}
+
+// UnmarshalBinary decodes a secret key encoded by MarshalBinary
+func (s *SecretBenaloh) UnmarshalBinary(data []byte) error {
+	key, err := decodeSecretBenaloh(data)
+	if err != nil {
+		return err
+	}
+	key.precompute()
+	*s = key
+	return nil
+}
+
+// decodeSecretBenaloh decodes a secret key encoded by MarshalBinary
+// without building its decryption tables
+func decodeSecretBenaloh(data []byte) (SecretBenaloh, error) {
+	d := newKeyDecoder(data, secretBenalohKey, keyEncodingVersion)
+	n, y, r, phi := d.int(), d.int(), d.int(), d.int()
+	var factors []PrimePower
+	if count := d.int(); d.err == nil {
+		if !count.IsInt64() || count.Int64() > 64 {
+			return SecretBenaloh{}, fmt.Errorf("%w: too many factors", ErrInvalidKey)
+		}
+		factors = make([]PrimePower, count.Int64())
+		for i := range factors {
+			prime, exp := d.int(), d.int()
+			if d.err != nil {
+				break
+			}
+			// r < n so no exponent can be larger than the size of n
+			if !prime.IsUint64() || !exp.IsInt64() || exp.Int64() > int64(n.BitLen()) {
+				return SecretBenaloh{}, fmt.Errorf("%w: malformed factor", ErrInvalidKey)
+			}
+			factors[i] = PrimePower{Prime: prime.Uint64(), Exp: int(exp.Int64())}
+		}
+	}
+	if err := d.finish(); err != nil {
+		return SecretBenaloh{}, err
+	}
+	if err := checkBenalohParams(n, y, r); err != nil {
+		return SecretBenaloh{}, err
+	}
+	prod, err := plaintextModulus(factors, r.BitLen())
+	if err != nil {
+		return SecretBenaloh{}, fmt.Errorf("%w: %v", ErrWeakParameters, err)
+	}
+	if prod.Cmp(r) != 0 {
+		return SecretBenaloh{}, fmt.Errorf("%w: the factors don't match r", ErrInvalidKey)
+	}
+	// p is the factor of n such that r | p - 1
+	p, q := paillierFactors(n, phi)
+	if p == nil {
+		return SecretBenaloh{}, fmt.Errorf("%w: n can't be factored from phi", ErrInvalidKey)
+	}
+	if bigMod(subNew(p, oneInt), r).Sign() != 0 {
+		p = q
+	}
+	pOverR, rem := nInt().QuoRem(subNew(p, oneInt), r, nInt())
+	if rem.Sign() != 0 || nInt().GCD(nil, nil, pOverR, r).Cmp(oneInt) != 0 {
+		return SecretBenaloh{}, fmt.Errorf("%w: r doesn't divide p - 1 exactly once", ErrInvalidKey)
+	}
+	key := SecretBenaloh{
+		phi:     phi,
+		n:       n,
+		y:       y,
+		r:       r,
+		p:       p,
+		pOverR:  pOverR,
+		factors: newBenalohFactors(factors, r),
+	}
+	if !key.generates(y) {
+		return SecretBenaloh{}, fmt.Errorf("%w: y ** ((p - 1) / l) is 1 mod p for a prime l of r", ErrInvalidKey)
+	}
+	// the public key is encoded only as n, y and r
+	key.bind = newBinding(schemeBenaloh, PublicBenaloh{n: n, y: y, r: r})
+	key.precomputeDigits()
+	return key, nil
+}
+
+func checkBenalohParams(n, y, r *big.Int) error {
+	if n.Cmp(oneInt) <= 0 || n.Bit(0) == 0 {
+		return fmt.Errorf("%w: n must be odd and greater than 1", ErrInvalidKey)
+	}
+	if r.Cmp(oneInt) <= 0 || r.Cmp(n) >= 0 {
+		return fmt.Errorf("%w: r must be in [2, n)", ErrInvalidKey)
+	}
+	if !isUnit(y, n) {
+		return fmt.Errorf("%w: y is not invertible mod n", ErrInvalidKey)
+	}
+	return nil
+}
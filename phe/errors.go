@@ -0,0 +1,56 @@
+package phe
+
+import (
+	"errors"
+)
+
+var (
+	// ErrInvalidCiphertext is returned when a ciphertext is not an element
+	// of the ciphertext space of the key
+	ErrInvalidCiphertext = errors.New("phe: invalid ciphertext")
+	// ErrKeyMismatch is returned when a ciphertext is used with a key
+	// other than the one that produced it
+	ErrKeyMismatch = errors.New("phe: ciphertext belongs to another key")
+	// ErrUnknownKey is returned when a KeyRing holds no key for a ciphertext
+	ErrUnknownKey = errors.New("phe: no key for the ciphertext")
+	// ErrDecryptionFailed is returned when a ciphertext doesn't decrypt
+	// to any plaintext under the secret key
+	ErrDecryptionFailed = errors.New("phe: decryption failed")
+	// ErrWeakParameters is returned when the parameters given to the key
+	// generation can't produce a secure key
+	ErrWeakParameters = errors.New("phe: weak parameters")
+	// ErrInvalidKey is returned when an encoded key can't be decoded
+	ErrInvalidKey = errors.New("phe: invalid key")
+	// ErrWrongPassphrase is returned when an encrypted secret key can't be
+	// decrypted, either because the passphrase is wrong or because the
+	// encrypted key was modified
+	ErrWrongPassphrase = errors.New("phe: wrong passphrase or corrupted key")
+	// ErrOverflow is returned when a decrypted plaintext falls into the
+	// guard band between the positive and the negative values, or doesn't
+	// fit in the requested type
+	ErrOverflow = errors.New("phe: plaintext overflow")
+	// ErrInvalidTable is returned when a decryption table file is
+	// malformed, was modified or was written for another key
+	ErrInvalidTable = errors.New("phe: invalid decryption table")
+	// ErrEntropy is returned when the entropy source of a key fails,
+	// the error of the source itself can be retrieved with errors.Unwrap
+	ErrEntropy = errors.New("phe: entropy source failed")
+)
+
+// entropyError wraps the error of an entropy source so that it
+// matches ErrEntropy
+type entropyError struct {
+	err error
+}
+
+func (e entropyError) Error() string {
+	return ErrEntropy.Error() + ": " + e.err.Error()
+}
+
+func (e entropyError) Is(target error) bool {
+	return target == ErrEntropy
+}
+
+func (e entropyError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,139 @@
+package phe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	cRand "crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// The encrypted secret keys are encoded as
+//
+//	version (1 byte) | iterations (4 bytes) | salt (16 bytes) | nonce (12 bytes) | sealed key
+//
+// The AES-256 key is derived from the passphrase and the salt with
+// PBKDF2-HMAC-SHA256 and the binary encoding of the secret key is sealed
+// with AES-GCM. Everything before the sealed key is authenticated as
+// additional data so the header can't be changed either
+
+const (
+	keyFileVersion    = 1
+	keyFileIterations = 600000
+	// keyFileMaxIterations bounds the work a forged header can ask for
+	keyFileMaxIterations = 1 << 26
+	keyFileSaltSize      = 16
+	keyFileNonceSize     = 12
+	keyFileHeaderSize    = 1 + 4 + keyFileSaltSize + keyFileNonceSize
+)
+
+// EncryptSecretKey encrypts the binary encoding of sk under the passphrase
+// so that the key can be kept at rest, DecryptSecretKey reverses it
+func EncryptSecretKey(sk SecretKey, passphrase []byte) ([]byte, error) {
+	m, ok := sk.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T can't be encoded", ErrInvalidKey, sk)
+	}
+	plain, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(plain)
+
+	header := make([]byte, keyFileHeaderSize)
+	header[0] = keyFileVersion
+	binary.BigEndian.PutUint32(header[1:], keyFileIterations)
+	if _, err := cRand.Read(header[5:]); err != nil {
+		return nil, entropyError{err}
+	}
+	salt := header[5 : 5+keyFileSaltSize]
+	nonce := header[5+keyFileSaltSize:]
+
+	aead, err := newKeyFileAEAD(passphrase, salt, keyFileIterations)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, plain, header), nil
+}
+
+// DecryptSecretKey decrypts a secret key encrypted by EncryptSecretKey
+//
+// It returns ErrWrongPassphrase if the passphrase is wrong or the data
+// was modified and ErrInvalidKey if the data is malformed
+func DecryptSecretKey(data, passphrase []byte) (SecretKey, error) {
+	if len(data) < keyFileHeaderSize {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidKey)
+	}
+	if data[0] != keyFileVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidKey, data[0])
+	}
+	iterations := binary.BigEndian.Uint32(data[1:])
+	if iterations == 0 || iterations > keyFileMaxIterations {
+		return nil, fmt.Errorf("%w: unsupported iteration count %d", ErrInvalidKey, iterations)
+	}
+	header := data[:keyFileHeaderSize]
+	salt := header[5 : 5+keyFileSaltSize]
+	nonce := header[5+keyFileSaltSize:]
+
+	aead, err := newKeyFileAEAD(passphrase, salt, int(iterations))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, data[keyFileHeaderSize:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	defer wipe(plain)
+	return unmarshalSecretKey(plain)
+}
+
+func newKeyFileAEAD(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	key := pbkdf2(sha256.New, passphrase, salt, iterations, 32)
+	defer wipe(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key of keyLen bytes as defined in RFC 8018
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	var index [4]byte
+	for block := 1; block <= blocks; block++ {
+		// U_1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(index[:], uint32(block))
+		prf.Write(index[:])
+		key = prf.Sum(key)
+		t := key[len(key)-hashLen:]
+		copy(u, t)
+		// T = U_1 ^ U_2 ^ ... ^ U_iterations where U_i = PRF(password, U_(i-1))
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return key[:keyLen]
+}
+
+// wipe overwrites b with zeros
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
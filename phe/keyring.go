@@ -0,0 +1,86 @@
+package phe
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// KeyRing holds secret keys by the fingerprint of their public key
+// and decrypts every ciphertext with the key that produced it
+//
+// It is useful when keys are rotated and ciphertexts of several keys
+// end up together. A KeyRing is safe for concurrent use
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]SecretKey
+}
+
+// NewKeyRing returns a KeyRing holding the given keys
+func NewKeyRing(keys ...SecretKey) *KeyRing {
+	k := &KeyRing{keys: make(map[[sha256.Size]byte]SecretKey, len(keys))}
+	for _, s := range keys {
+		k.Add(s)
+	}
+	return k
+}
+
+// Add adds a secret key to the ring replacing any key with
+// the same fingerprint
+func (k *KeyRing) Add(s SecretKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[s.Fingerprint()] = s
+}
+
+// Remove removes the key with the given fingerprint from the ring
+func (k *KeyRing) Remove(fingerprint [sha256.Size]byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, fingerprint)
+}
+
+// Get returns the key with the given fingerprint
+func (k *KeyRing) Get(fingerprint [sha256.Size]byte) (SecretKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	s, ok := k.keys[fingerprint]
+	return s, ok
+}
+
+// Len returns the number of keys in the ring
+func (k *KeyRing) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys)
+}
+
+// Decrypt decrypts the ciphertext with the key whose fingerprint is
+// bound to the ciphertext
+//
+// It returns ErrUnknownKey if the ring holds no such key, otherwise
+// it fails in the same way as the DecryptE of the key
+func (k *KeyRing) Decrypt(c *Ciphertext) (*big.Int, error) {
+	if c == nil {
+		return nil, ErrInvalidCiphertext
+	}
+	s, ok := k.Get(c.bind.key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v key %x", ErrUnknownKey, c.bind.scheme, c.bind.key[:8])
+	}
+	return s.DecryptE(c)
+}
+
+// DecryptVector decrypts every ciphertext with the key that produced it
+// and stops at the first error
+func (k *KeyRing) DecryptVector(v []*Ciphertext) (ans []*big.Int, err error) {
+	N := len(v)
+	ans = make([]*big.Int, N, N)
+	for i := 0; i < N; i++ {
+		if ans[i], err = k.Decrypt(v[i]); err != nil {
+			return nil, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package phe
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKeyRing(t *testing.T) {
+	assert := assert.New(t)
+	p1, s1 := GenNewKeysPaillier(512)
+	p2, s2 := GenNewKeysPaillier(512)
+	p3, s3 := GenNewKeysBenaloh(1009, 512)
+	assert.Equal(p1.Fingerprint(), s1.Fingerprint())
+	assert.Equal(p3.Fingerprint(), s3.Fingerprint())
+	assert.NotEqual(p1.Fingerprint(), p2.Fingerprint())
+
+	ring := NewKeyRing(s1, s3)
+	assert.Equal(2, ring.Len())
+	m, err := ring.DecryptVector([]*Ciphertext{p1.EncryptUint64(13), p3.EncryptUint64(69)})
+	assert.Nil(err)
+	assert.Equal(uint64(13), m[0].Uint64())
+	assert.Equal(uint64(69), m[1].Uint64())
+
+	c2 := p2.EncryptUint64(56)
+	_, err = ring.Decrypt(c2)
+	assert.True(errors.Is(err, ErrUnknownKey), "Expected no key for p2")
+	ring.Add(s2.Copy())
+	m1, err := ring.Decrypt(c2)
+	assert.Nil(err)
+	assert.Equal(uint64(56), m1.Uint64())
+	ring.Remove(p2.Fingerprint())
+	_, ok := ring.Get(p2.Fingerprint())
+	assert.False(ok)
+
+	// Mixing ciphertexts of different keys must be rejected
+	_, err = p1.AddE(p1.EncryptUint64(13), c2)
+	assert.True(errors.Is(err, ErrKeyMismatch), "Expected a ciphertext of p2 to be rejected")
+	_, err = p1.MulIntE(c2, nIntSetUint64(2))
+	assert.True(errors.Is(err, ErrKeyMismatch), "Expected a ciphertext of p2 to be rejected")
+	_, err = p3.MulUint64E(c2, 2)
+	assert.True(errors.Is(err, ErrKeyMismatch), "Expected a Paillier ciphertext to be rejected")
+	assert.Panics(func() { p1.Add(c2, c2) })
+}
@@ -0,0 +1,29 @@
+package phe
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps f read-only and copy-on-write into memory, the mapping
+// stays valid once f is closed
+func mapFile(f *os.File) ([]byte, error) {
+	fd := int(f.Fd())
+	// the size must not change between fileSize and the mapping
+	if err := syscall.Flock(fd, syscall.LOCK_SH); err != nil {
+		return nil, err
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+	size, err := fileSize(f)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	return syscall.Mmap(fd, 0, size, syscall.PROT_READ, syscall.MAP_PRIVATE)
+}
+
+func unmapFile(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package phe
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads f into memory, there is no mapping outside of Linux
+func mapFile(f *os.File) ([]byte, error) {
+	size, err := fileSize(f)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,232 @@
+package phe
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"sync"
+)
+
+// ModContext computes modulo a fixed odd modulus, such as the n of a
+// Benaloh key or the n ** 2 of a Paillier key, without allocating
+//
+// The intermediate values live in scratch space allocated once by
+// NewModContext, Mul and Exp keep them in Montgomery form, and the results
+// are written to the words already held by the destination, so a long
+// chain of Add, Mul and Exp calls into the same destinations allocates
+// nothing once the scratch space has grown to its size. The running time
+// of Add, Mul and Exp doesn't depend on the values, only on their sizes
+//
+// A ModContext must not be used by several go routines at once, Copy
+// returns another one for the same modulus
+type ModContext struct {
+	mm    *montModulus
+	t     []uint
+	x     []uint
+	y     []uint
+	acc   []uint
+	sel   []uint
+	unit  []uint
+	ew    []uint
+	table [][]uint
+	red   *big.Int
+}
+
+// NewModContext returns a ModContext for the modulus m
+//
+// It returns ErrInvalidKey if m is even or smaller than 3
+func NewModContext(m *big.Int) (*ModContext, error) {
+	if m.Cmp(nIntSetUint64(3)) < 0 || m.Bit(0) == 0 {
+		return nil, fmt.Errorf("%w: the modulus must be odd and greater than 2", ErrInvalidKey)
+	}
+	return newModContext(newMontModulus(copyInt(m))), nil
+}
+
+func newModContext(mm *montModulus) *ModContext {
+	n := len(mm.m)
+	c := &ModContext{
+		mm:    mm,
+		t:     make([]uint, n+2),
+		x:     make([]uint, n),
+		y:     make([]uint, n),
+		acc:   make([]uint, n),
+		sel:   make([]uint, n),
+		unit:  make([]uint, n),
+		ew:    make([]uint, n),
+		table: make([][]uint, 1<<montWindow),
+		red:   nInt(),
+	}
+	c.unit[0] = 1
+	for i := range c.table {
+		c.table[i] = make([]uint, n)
+	}
+	return c
+}
+
+// Copy returns a ModContext for the same modulus with its own scratch
+// space. The precomputed constants of the modulus are shared
+func (c *ModContext) Copy() *ModContext {
+	if c == nil {
+		return nil
+	}
+	return newModContext(c.mm)
+}
+
+// Modulus returns a copy of the modulus
+func (c *ModContext) Modulus() *big.Int {
+	return copyInt(c.mm.mBig)
+}
+
+// Add sets z = (x + y) mod m and returns z
+func (c *ModContext) Add(z, x, y *big.Int) *big.Int {
+	c.load(c.x, x)
+	c.load(c.y, y)
+	var carry, borrow uint
+	for j := range c.acc {
+		c.acc[j], carry = bits.Add(c.x[j], c.y[j], carry)
+	}
+	for j := range c.sel {
+		c.sel[j], borrow = bits.Sub(c.acc[j], c.mm.m[j], borrow)
+	}
+	// keep acc - m when the addition carried or the subtraction didn't
+	// borrow, in the same way as montModulus.mul
+	mask := -(carry | (borrow ^ 1))
+	for j := range c.acc {
+		c.acc[j] = (c.sel[j] & mask) | (c.acc[j] &^ mask)
+	}
+	return c.store(z, c.acc)
+}
+
+// Mul sets z = x * y mod m and returns z
+func (c *ModContext) Mul(z, x, y *big.Int) *big.Int {
+	mm := c.mm
+	c.load(c.x, x)
+	c.load(c.y, y)
+	// x * y * R ** (-1) is multiplied by R ** 2 to leave the Montgomery form
+	mm.mul(c.acc, c.x, c.y, c.t)
+	mm.mul(c.acc, c.acc, mm.rr, c.t)
+	return c.store(z, c.acc)
+}
+
+// Exp sets z = x ** e mod m for a non negative e and returns z
+//
+// Only the bit length of e leaks through the running time
+func (c *ModContext) Exp(z, x, e *big.Int) *big.Int {
+	return c.exp(z, x, e, e.BitLen(), nil)
+}
+
+// exp sets z = x ** e mod m going through all the `width` lowest bits of
+// e, whatever their value, with a fixed window so the sequence of
+// operations doesn't depend on e. e must be smaller than 2 ** width. When
+// trace is not nil every operation is appended to it, which is only used
+// to test the above
+func (c *ModContext) exp(z, x, e *big.Int, width int, trace *[]byte) *big.Int {
+	mm := c.mm
+	if e.BitLen() > width {
+		width = e.BitLen()
+	}
+	windows := (width + montWindow - 1) / montWindow
+	if words := (windows*montWindow + bits.UintSize - 1) / bits.UintSize; len(c.ew) < words {
+		c.ew = make([]uint, words)
+	}
+	c.load(c.x, x)
+	ew := c.ew
+	for i := range ew {
+		ew[i] = 0
+	}
+	for i, w := range e.Bits() {
+		ew[i] = uint(w)
+	}
+
+	// table[i] = x ** i in Montgomery form
+	table := c.table
+	copy(table[0], mm.one)
+	mm.mul(table[1], c.x, mm.rr, c.t)
+	for i := 2; i < len(table); i++ {
+		mm.mul(table[i], table[i-1], table[1], c.t)
+	}
+
+	acc := c.acc
+	copy(acc, mm.one)
+	for w := windows - 1; w >= 0; w-- {
+		for i := 0; i < montWindow; i++ {
+			mm.mul(acc, acc, acc, c.t)
+			if trace != nil {
+				*trace = append(*trace, 's')
+			}
+		}
+		// bits.UintSize is a multiple of montWindow so a window
+		// never spans two words
+		idx := w * montWindow
+		ctSelect(c.sel, table, (ew[idx/bits.UintSize]>>(idx%bits.UintSize))&(1<<montWindow-1))
+		mm.mul(acc, acc, c.sel, c.t)
+		if trace != nil {
+			*trace = append(*trace, 't', 'm')
+		}
+	}
+	// acc * 1 * R ** (-1) takes acc out of the Montgomery form
+	mm.mul(acc, acc, c.unit, c.t)
+	return c.store(z, acc)
+}
+
+// modContextPool hands out ModContexts for one modulus so that every
+// operation of a key has scratch space of its own. The keys and all their
+// copies share the pool and, through it, the constants of the modulus
+type modContextPool struct {
+	mm   *montModulus
+	pool sync.Pool
+}
+
+func newModContextPool(m *big.Int) *modContextPool {
+	p := &modContextPool{mm: newMontModulus(m)}
+	p.pool.New = func() interface{} {
+		return newModContext(p.mm)
+	}
+	return p
+}
+
+// get returns a ModContext that belongs to the caller until it is given
+// back with put
+func (p *modContextPool) get() *ModContext {
+	return p.pool.Get().(*ModContext)
+}
+
+func (p *modContextPool) put(c *ModContext) {
+	p.pool.Put(c)
+}
+
+// exp returns x ** e mod m going through all the `width` lowest bits of
+// e in constant time, see ModContext.exp
+func (p *modContextPool) exp(x, e *big.Int, width int) *big.Int {
+	c := p.get()
+	defer p.put(c)
+	return c.exp(nInt(), x, e, width, nil)
+}
+
+// load copies x mod m into the words dst
+func (c *ModContext) load(dst []uint, x *big.Int) {
+	if x.Sign() < 0 || x.Cmp(c.mm.mBig) >= 0 {
+		x = c.red.Mod(x, c.mm.mBig)
+	}
+	w := x.Bits()
+	for i := range dst {
+		if i < len(w) {
+			dst[i] = uint(w[i])
+		} else {
+			dst[i] = 0
+		}
+	}
+}
+
+// store sets z to the words src reusing the words of z when they fit
+func (c *ModContext) store(z *big.Int, src []uint) *big.Int {
+	zw := z.Bits()
+	if cap(zw) < len(src) {
+		zw = make([]big.Word, len(src))
+	}
+	zw = zw[:len(src)]
+	for i, v := range src {
+		zw[i] = big.Word(v)
+	}
+	return z.SetBits(zw)
+}
@@ -0,0 +1,52 @@
+//go:build !race
+// +build !race
+
+package phe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+// The race detector allocates on its own so the test only runs without it
+
+func TestModContextAllocs(t *testing.T) {
+	p, _ := GenNewKeysPaillier(512)
+	c, _ := NewModContext(p.n2)
+	x := nInt().Rand(rnd, p.n2)
+	y := nInt().Rand(rnd, p.n2)
+	e := nInt().Rand(rnd, p.n)
+	z := c.Mul(nInt(), x, y)
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Mul(z, z, x)
+		c.Add(z, z, y)
+		c.Exp(z, z, e)
+	})
+	assert.Equal(t, 0.0, allocs, "Expected no allocation once z has its words")
+}
+
+// BenchmarkContextChain runs the homomorphic Add and MulInt of Paillier on
+// a ModContext, which must not allocate
+func BenchmarkContextChain(b *testing.B) {
+	p, _ := GenNewKeysPaillier(1024)
+	c, _ := NewModContext(p.n2)
+	v := make([]*big.Int, 64)
+	for i := range v {
+		v[i] = p.EncryptUint64(uint64(i)).num
+	}
+	k := nIntSetUint64(69)
+	acc := copyInt(v[0])
+	step := func(x *big.Int) {
+		c.Mul(acc, acc, x)
+		c.Exp(acc, acc, k)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { step(v[1]) }); allocs != 0 {
+		b.Fatalf("Expected Add and MulInt through a ModContext not to allocate, got %v allocs/op", allocs)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		step(v[i%len(v)])
+	}
+}
@@ -0,0 +1,130 @@
+package phe
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+func TestModContext(t *testing.T) {
+	assert := assert.New(t)
+	p, _ := GenNewKeysPaillier(512)
+	for _, mod := range []*big.Int{nIntSetUint64(1000000007), nIntSetUint64(1<<64 - 59), p.n, p.n2} {
+		c, err := NewModContext(mod)
+		assert.Nil(err)
+		assert.Equal(mod, c.Modulus())
+		for i := 0; i < 16; i++ {
+			x := nInt().Rand(rnd, mod)
+			y := nInt().Rand(rnd, mod)
+			e := nInt().Rand(rnd, mod)
+			assert.Equal(bigMod(addNew(x, y), mod), c.Add(nInt(), x, y))
+			assert.Equal(bigMod(mulNew(x, y), mod), c.Mul(nInt(), x, y))
+			assert.Equal(nInt().Exp(x, e, mod), c.Exp(nInt(), x, e))
+		}
+		// the inputs are reduced and the destination may alias them
+		x := nInt().Rand(rnd, mod)
+		y := nInt().Sub(x, mulNew(mod, nIntSetUint64(3)))
+		assert.Equal(bigMod(mulNew(x, x), mod), c.Mul(y, y, x))
+		assert.Equal(oneInt, c.Exp(x, x, zeroInt))
+		assert.Equal(bigMod(subNew(mod, oneInt), mod), c.Add(nInt(), subNew(mod, oneInt), mod))
+	}
+	for _, mod := range []*big.Int{zeroInt, oneInt, nIntSetUint64(2), nIntSetUint64(1 << 40)} {
+		_, err := NewModContext(mod)
+		assert.True(errors.Is(err, ErrInvalidKey), "Expected ErrInvalidKey for %v", mod)
+	}
+}
+
+func TestModContextConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysPaillier(512)
+	pb, sb := GenNewKeysBenaloh(1009, 512)
+	assert.True(p.Copy().(PublicPaillier).ctxs == p.ctxs, "Expected the copies to share the pool")
+
+	// the keys are used by all the go routines at once without being copied
+	for _, keys := range []struct {
+		p PublicKey
+		s SecretKey
+	}{{p, s}, {pb, sb}} {
+		a := keys.p.EncryptUint64(13)
+		got := make([][]*Ciphertext, 8)
+		var wg sync.WaitGroup
+		for w := range got {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 32; i++ {
+					got[w] = append(got[w], keys.p.Add(a, keys.p.MulUint64(a, uint64(i))))
+				}
+			}(w)
+		}
+		wg.Wait()
+		for _, v := range got {
+			for i, c := range v {
+				assert.Equal(uint64(13*(i+1)), keys.s.Decrypt(c).Uint64())
+			}
+		}
+	}
+}
+
+func BenchmarkAddChain(b *testing.B) {
+	p, _ := GenNewKeysPaillier(1024)
+	v := make([]*big.Int, 1000)
+	for i := range v {
+		v[i] = p.EncryptUint64(uint64(i)).num
+	}
+	b.Run("BigInt", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			acc := oneInt
+			for _, x := range v {
+				acc = bigMod(mulNew(acc, x), p.n2)
+			}
+		}
+	})
+	b.Run("ModContext", func(b *testing.B) {
+		b.ReportAllocs()
+		c, _ := NewModContext(p.n2)
+		acc := nInt()
+		for i := 0; i < b.N; i++ {
+			acc.SetInt64(1)
+			for _, x := range v {
+				c.Mul(acc, acc, x)
+			}
+		}
+	})
+	b.Run("PublicKey", func(b *testing.B) {
+		b.ReportAllocs()
+		cts := make([]*Ciphertext, len(v))
+		for i, x := range v {
+			cts[i] = &Ciphertext{num: x, bind: p.bind}
+		}
+		for i := 0; i < b.N; i++ {
+			acc := cts[0]
+			for _, x := range cts[1:] {
+				acc = p.Add(acc, x)
+			}
+		}
+	})
+}
+
+func BenchmarkMulChain(b *testing.B) {
+	p, _ := GenNewKeysPaillier(1024)
+	x := p.EncryptUint64(69).num
+	e := nInt().Rand(rnd, p.n)
+	b.Run("BigInt", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			powMod(x, e, p.n2)
+		}
+	})
+	b.Run("ModContext", func(b *testing.B) {
+		b.ReportAllocs()
+		c, _ := NewModContext(p.n2)
+		z := nInt()
+		for i := 0; i < b.N; i++ {
+			c.Exp(z, x, e)
+		}
+	})
+}
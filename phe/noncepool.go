@@ -0,0 +1,141 @@
+package phe
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+)
+
+// NoncePool precomputes the nonces r ** n mod (n ** 2) of a Paillier key
+// in background go routines, which is most of the cost of an encryption
+//
+// A PublicPaillier given a pool through WithNoncePool takes a ready nonce
+// for every encryption and only computes it online when the pool is empty,
+// so the online encryption costs one multiplication. Every nonce is handed
+// out only once. A NoncePool is safe for concurrent use and the copies of
+// the key share it
+type NoncePool struct {
+	// the counters are first to keep them 64-bit aligned
+	produced uint64
+	served   uint64
+	misses   uint64
+
+	// key computes the nonces, it has no pool itself
+	key    PublicPaillier
+	nonces chan *big.Int
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	err    atomic.Value
+}
+
+// NoncePoolStats is a snapshot of the state of a NoncePool
+type NoncePoolStats struct {
+	// Capacity is the maximal number of nonces kept ready
+	Capacity int
+	// Available is the number of nonces ready to be used
+	Available int
+	// Produced is the number of nonces computed by the pool
+	Produced uint64
+	// Served is the number of encryptions that used a ready nonce
+	Served uint64
+	// Misses is the number of encryptions that found the pool empty
+	// and computed their nonce online
+	Misses uint64
+}
+
+// NewNoncePool starts `workers` go routines that keep up to `capacity`
+// nonces of p ready until ctx is done or Close is called
+//
+// The nonces are computed from the entropy source of p
+func NewNoncePool(ctx context.Context, p PublicPaillier, capacity, workers int) *NoncePool {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p.pool = nil
+	pool := &NoncePool{
+		key:    p,
+		nonces: make(chan *big.Int, capacity),
+		cancel: cancel,
+	}
+	pool.wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go pool.fill(ctx)
+	}
+	return pool
+}
+
+func (pool *NoncePool) fill(ctx context.Context) {
+	defer pool.wg.Done()
+	for {
+		rn, err := pool.key.freshNonce()
+		if err != nil {
+			// the online encryption will report the error itself
+			pool.err.Store(err)
+			return
+		}
+		select {
+		case pool.nonces <- rn:
+			atomic.AddUint64(&pool.produced, 1)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// get returns a ready nonce or false if there is none
+func (pool *NoncePool) get() (*big.Int, bool) {
+	select {
+	case rn := <-pool.nonces:
+		atomic.AddUint64(&pool.served, 1)
+		return rn, true
+	default:
+		atomic.AddUint64(&pool.misses, 1)
+		return nil, false
+	}
+}
+
+// Close stops the go routines of the pool and waits for them to exit
+//
+// The keys using the pool can still encrypt, they use the nonces left
+// in the pool and then compute them online
+func (pool *NoncePool) Close() {
+	pool.cancel()
+	pool.wg.Wait()
+}
+
+// Err returns the error that stopped the go routines of the pool
+// if the entropy source failed
+func (pool *NoncePool) Err() error {
+	if err, ok := pool.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Stats returns the current statistics of the pool
+func (pool *NoncePool) Stats() NoncePoolStats {
+	return NoncePoolStats{
+		Capacity:  cap(pool.nonces),
+		Available: len(pool.nonces),
+		Produced:  atomic.LoadUint64(&pool.produced),
+		Served:    atomic.LoadUint64(&pool.served),
+		Misses:    atomic.LoadUint64(&pool.misses),
+	}
+}
+
+// WithNoncePool returns a copy of the key that takes its nonces from pool
+//
+// It returns ErrKeyMismatch if the pool was created for another key
+func (p PublicPaillier) WithNoncePool(pool *NoncePool) (PublicPaillier, error) {
+	if pool.key.bind != p.bind {
+		return PublicPaillier{}, fmt.Errorf("%w: the nonce pool belongs to another key", ErrKeyMismatch)
+	}
+	p.pool = pool
+	return p, nil
+}
@@ -0,0 +1,56 @@
+package phe
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNoncePool(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysPaillier(512)
+	pool := NewNoncePool(context.Background(), p, 16, 2)
+	defer pool.Close()
+	pp, err := p.WithNoncePool(pool)
+	assert.Nil(err)
+	for pool.Stats().Available < 16 {
+		time.Sleep(time.Millisecond)
+	}
+
+	msgs := []uint64{0, 13, 56, 69}
+	v := EncryptVectorUint64Parallel(pp, msgs, uint64(runtime.GOMAXPROCS(-1)))
+	for i, m := range DecryptVector(s, v) {
+		assert.Equal(msgs[i], m.Uint64())
+	}
+	stats := pool.Stats()
+	assert.Equal(16, stats.Capacity)
+	assert.Equal(uint64(len(msgs)), stats.Served+stats.Misses)
+	assert.True(stats.Produced >= 16)
+	assert.NotEqual(v[0].num, v[1].num)
+
+	p2, _ := GenNewKeysPaillier(512)
+	_, err = p2.WithNoncePool(pool)
+	assert.True(errors.Is(err, ErrKeyMismatch), "Expected the pool of another key to be rejected")
+}
+
+func TestNoncePoolShutdown(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysPaillier(512)
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := NewNoncePool(ctx, p, 4, 1)
+	cancel()
+	pool.Close()
+	pp, _ := p.WithNoncePool(pool)
+	for i := 0; i < 8; i++ {
+		assert.Equal(uint64(69), s.Decrypt(pp.EncryptUint64(69)).Uint64(), "Expected a stopped pool to fall back to online nonces")
+	}
+	assert.True(pool.Stats().Misses > 0)
+
+	p.random = failingReader{}
+	pool = NewNoncePool(context.Background(), p, 4, 1)
+	pool.Close()
+	assert.True(errors.Is(pool.Err(), ErrEntropy))
+}
@@ -0,0 +1,66 @@
+package phe
+
+import (
+	cRand "crypto/rand"
+	"io"
+	"sync"
+)
+
+// Option configures the generation of a new pair of keys
+type Option func(*keyOptions)
+
+type keyOptions struct {
+	random        io.Reader
+	shortExponent bool
+}
+
+// WithRandom sets the entropy source used for the primes of the key
+// and for every random value the generated keys will need afterwards
+// such as the nonces used in the encryption
+//
+// By default crypto/rand.Reader is used. The reader doesn't have to be
+// safe for concurrent use, the keys will serialize the access to it
+func WithRandom(random io.Reader) Option {
+	return func(o *keyOptions) {
+		o.random = random
+	}
+}
+
+// WithShortExponents makes the Paillier public key compute its nonces as
+// (h ** n) ** a mod (n ** 2) with h = -x ** 2 mod n for a random x and a
+// short random exponent a, twice as long as the security level of n,
+// instead of r ** n with r as long as n
+//
+// The ciphertexts are ordinary Paillier ciphertexts, only the encryption
+// is several times faster thanks to a precomputed table of powers of h ** n.
+// The mode is part of the encoding of the public key. The Benaloh key
+// generation ignores it
+func WithShortExponents() Option {
+	return func(o *keyOptions) {
+		o.shortExponent = true
+	}
+}
+
+func newKeyOptions(opts []Option) keyOptions {
+	o := keyOptions{random: cRand.Reader}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.random != cRand.Reader {
+		o.random = &lockedReader{r: o.random}
+	}
+	return o
+}
+
+// lockedReader serializes the reads so that copies of the same key can
+// share a reader that is not safe for concurrent use
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *lockedReader) Read(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(b)
+}
@@ -1,48 +1,89 @@
 package phe
 
 import (
-	cRand "crypto/rand"
+	"crypto/sha256"
+	"io"
 	"math/big"
-	mRand "math/rand"
 )
 
 // PublicPaillier represents the public key in the Paillier cryptosystem
 type PublicPaillier struct {
-	n    *big.Int
-	n2   *big.Int
-	g    *big.Int
-	gInv *big.Int
-	r    *mRand.Rand
+	n      *big.Int
+	n2     *big.Int
+	g      *big.Int
+	fastG  bool // g = n + 1
+	random io.Reader
+	pool   *NoncePool
+	bind   binding
+	ctxs   *modContextPool // modulo n ** 2, see modCtx
+	// h, shortBits and hnTable are only set in the short exponent mode
+	// where the nonces are (h ** n) ** a for a of shortBits bits
+	h         *big.Int
+	shortBits int
+	hnTable   *fixedBaseTable
 }
 
 // SecretPaillier represents the secret key in the Paillier crypstosystem
+//
+// Besides lambda and mu it keeps the factors p > q of n and the values
+// needed to decrypt modulo p ** 2 and q ** 2 with the CRT
 type SecretPaillier struct {
-	n      *big.Int
-	n2     *big.Int
-	lambda *big.Int
-	phi    *big.Int
-	mu     *big.Int
+	n       *big.Int
+	n2      *big.Int
+	g       *big.Int
+	lambda  *big.Int
+	phi     *big.Int
+	mu      *big.Int
+	p       *big.Int
+	q       *big.Int
+	pSquare *big.Int
+	qSquare *big.Int
+	hp      *big.Int
+	hq      *big.Int
+	qInv    *big.Int
+	pCtxs   *modContextPool // modulo p ** 2
+	qCtxs   *modContextPool // modulo q ** 2
+	bind    binding
+	guard   *big.Int // see WithGuardBand
 }
 
 // CopyPublicPaillier to PublicPaillier
 func CopyPublicPaillier(p PublicPaillier) PublicPaillier {
 	return PublicPaillier{
-		n:    copyInt(p.n),
-		n2:   copyInt(p.n2),
-		g:    copyInt(p.g),
-		gInv: copyInt(p.gInv),
-		r:    mRand.New(mRand.NewSource(p.r.Int63())),
+		n:         copyInt(p.n),
+		n2:        copyInt(p.n2),
+		g:         copyInt(p.g),
+		fastG:     p.fastG,
+		random:    p.random,
+		pool:      p.pool,
+		bind:      p.bind,
+		ctxs:      p.ctxs,
+		h:         copyIntOrNil(p.h),
+		shortBits: p.shortBits,
+		hnTable:   p.hnTable,
 	}
 }
 
 // CopySecretPaillier to SecretPaillier
 func CopySecretPaillier(s SecretPaillier) SecretPaillier {
 	return SecretPaillier{
-		n:      copyInt(s.n),
-		n2:     copyInt(s.n2),
-		lambda: copyInt(s.lambda),
-		phi:    copyInt(s.phi),
-		mu:     copyInt(s.mu),
+		n:       copyInt(s.n),
+		n2:      copyInt(s.n2),
+		g:       copyInt(s.g),
+		lambda:  copyInt(s.lambda),
+		phi:     copyInt(s.phi),
+		mu:      copyInt(s.mu),
+		p:       copyInt(s.p),
+		q:       copyInt(s.q),
+		pSquare: copyInt(s.pSquare),
+		qSquare: copyInt(s.qSquare),
+		hp:      copyInt(s.hp),
+		hq:      copyInt(s.hq),
+		qInv:    copyInt(s.qInv),
+		pCtxs:   s.pCtxs,
+		qCtxs:   s.qCtxs,
+		bind:    s.bind,
+		guard:   copyIntOrNil(s.guard),
 	}
 }
 
@@ -56,6 +97,23 @@ func (s SecretPaillier) Copy() SecretKey {
 	return CopySecretPaillier(s)
 }
 
+func (p PublicPaillier) keyBinding() binding {
+	return p.bind
+}
+
+// Fingerprint returns the SHA-256 hash of the binary encoding of the key
+// without the short exponent mode, so every key of the same n and g has the
+// same fingerprint and decrypts the ciphertexts of the others
+func (p PublicPaillier) Fingerprint() [sha256.Size]byte {
+	return p.bind.key
+}
+
+// Fingerprint returns the fingerprint of the public key matching
+// the secret key
+func (s SecretPaillier) Fingerprint() [sha256.Size]byte {
+	return s.bind.key
+}
+
 // L function takes as argument a ciphertext x and returns (x - 1) / n
 func (p PublicPaillier) L(x *big.Int) *big.Int {
 	return divNew(subNew(x, oneInt), p.n)
@@ -66,65 +124,482 @@ func (s SecretPaillier) L(x *big.Int) *big.Int {
 	return divNew(subNew(x, oneInt), s.n)
 }
 
-func (p PublicPaillier) randInt() (ans *big.Int) {
-	ans, _ = cRand.Int(p.r, p.n)
-	return
+// paillierBinding returns the binding of the Paillier keys of n and g,
+// which is the one of the public key encoded only as n and g
+func paillierBinding(n, g *big.Int) binding {
+	return newBinding(schemePaillier, PublicPaillier{n: n, g: g})
+}
+
+// setShortExponent switches the key to the short exponent mode with the
+// generator h and exponents of `bits` bits, see WithShortExponents
+func (p *PublicPaillier) setShortExponent(h *big.Int, bits int) {
+	p.h = h
+	p.shortBits = bits
+	p.hnTable = newFixedBaseTable(powMod(h, p.n, p.n2), p.n2, bits)
+}
+
+// shortExponentBits returns twice the security level in bits of a
+// modulus of nBits bits, and never less than 2 * 80
+func shortExponentBits(nBits int) int {
+	if s := securityBits(nBits); s > 80 {
+		return 2 * s
+	}
+	return 2 * 80
+}
+
+// gPow returns g ** m mod (n ** 2) for the plaintext m taken mod n
+//
+// With g = n + 1 the binomial theorem gives g ** m = 1 + m * n mod (n ** 2)
+// so no exponentiation is needed, other generators such as the ones of
+// imported keys are exponentiated in constant time. A negative m becomes
+// n - |m| which decrypts to the same value without inverting g
+func (p PublicPaillier) gPow(m *big.Int) *big.Int {
+	m = nInt().Mod(m, p.n)
+	if p.fastG {
+		return add(mul(m, p.n), oneInt)
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return ctx.exp(nInt(), p.g, m, p.n.BitLen(), nil)
+}
+
+// modCtx returns a ModContext modulo n ** 2 that belongs to the caller
+// until it is given back with release, so the key can be used by several
+// go routines at once
+func (p PublicPaillier) modCtx() *ModContext {
+	if p.ctxs == nil {
+		return newModContext(newMontModulus(p.n2))
+	}
+	return p.ctxs.get()
+}
+
+func (p PublicPaillier) release(ctx *ModContext) {
+	if p.ctxs != nil {
+		p.ctxs.put(ctx)
+	}
+}
+
+func (p PublicPaillier) randInt() (*big.Int, error) {
+	return randomUnit(p.random, p.n)
+}
+
+// nonce returns r ** n mod (n ** 2) for a random r, taken
+// from the nonce pool of the key if there is a ready one
+func (p PublicPaillier) nonce() (*big.Int, error) {
+	if p.pool != nil {
+		if rn, ok := p.pool.get(); ok {
+			return rn, nil
+		}
+	}
+	return p.freshNonce()
+}
+
+func (p PublicPaillier) freshNonce() (*big.Int, error) {
+	if p.hnTable != nil {
+		a, err := randomInt(p.random, nInt().Lsh(oneInt, uint(p.shortBits)))
+		if err != nil {
+			return nil, err
+		}
+		return p.hnTable.exp(a), nil
+	}
+	r, err := p.randInt()
+	if err != nil {
+		return nil, err
+	}
+	return powMod(r, p.n, p.n2), nil
+}
+
+// Validate checks that the ciphertext is in (0, n ** 2) and coprime
+// with n, otherwise it returns ErrInvalidCiphertext
+//
+// Ciphertexts received from untrusted parties should be validated before
+// any operation, ValidateVector checks many of them at once
+func (p PublicPaillier) Validate(c *Ciphertext) error {
+	return validateCiphertext(c, p.n2, p.n)
+}
+
+// PlaintextModulus returns n, the plaintexts are integers mod n
+func (p PublicPaillier) PlaintextModulus() *big.Int {
+	return copyInt(p.n)
+}
+
+// CiphertextModulus returns n ** 2, the ciphertexts are integers mod n ** 2
+func (p PublicPaillier) CiphertextModulus() *big.Int {
+	return copyInt(p.n2)
+}
+
+// SecurityBits returns the security level in bits of the key, which
+// depends on the size of n
+func (p PublicPaillier) SecurityBits() int {
+	return securityBits(p.n.BitLen())
+}
+
+func (p PublicPaillier) validationModuli() (bound, n *big.Int) {
+	return p.n2, p.n
+}
+
+// precompute fills the values used by the CRT decryption
+//
+//	hp = L_p(g ** (p - 1) mod p ** 2) ** (-1) mod p
+//	hq = L_q(g ** (q - 1) mod q ** 2) ** (-1) mod q
+//
+// where L_p(x) = (x - 1) / p, it returns false if they don't exist
+func (s *SecretPaillier) precompute() bool {
+	s.pSquare = mulNew(s.p, s.p)
+	s.qSquare = mulNew(s.q, s.q)
+	s.qInv = invMod(s.q, s.p)
+	s.pCtxs = newModContextPool(s.pSquare)
+	s.qCtxs = newModContextPool(s.qSquare)
+	lp := divNew(subNew(s.pCtxs.exp(s.g, subNew(s.p, oneInt), s.p.BitLen()), oneInt), s.p)
+	lq := divNew(subNew(s.qCtxs.exp(s.g, subNew(s.q, oneInt), s.q.BitLen()), oneInt), s.q)
+	s.hp = invMod(lp, s.p)
+	s.hq = invMod(lq, s.q)
+	return s.qInv != nil && s.hp != nil && s.hq != nil
 }
 
 // Decrypt decrypts a ciphertext
 // using the formula L(c ** lambda mod (n ** 2)) * mu mod n
+//
+// The value is computed modulo p and q and recombined with the CRT,
+// exponentiating modulo p ** 2 and q ** 2 which is several times faster
 func (s SecretPaillier) Decrypt(c *Ciphertext) *big.Int {
-	return bigMod(mulNew(s.L(powMod(c.num, s.lambda, s.n2)), s.mu), s.n)
+	m, _ := s.decryptCRT(c.num)
+	return m
+}
+
+// DecryptE decrypts a ciphertext in the same way as Decrypt but returns
+// ErrInvalidCiphertext if c is not in (0, n ** 2) and ErrDecryptionFailed
+// if c ** lambda mod (n ** 2) is not equal to 1 mod n
+func (s SecretPaillier) DecryptE(c *Ciphertext) (*big.Int, error) {
+	if c == nil || c.num == nil || c.num.Sign() <= 0 || c.num.Cmp(s.n2) >= 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	m, ok := s.decryptCRT(c.num)
+	if !ok {
+		return nil, ErrDecryptionFailed
+	}
+	return m, nil
+}
+
+// DecryptSigned decrypts a ciphertext in the same way as DecryptE and
+// maps the plaintexts above n / 2 to the negative values m - n
+//
+// It returns ErrOverflow if the plaintext falls into the guard band of
+// the key, see WithGuardBand
+func (s SecretPaillier) DecryptSigned(c *Ciphertext) (*big.Int, error) {
+	m, err := s.DecryptE(c)
+	if err != nil {
+		return nil, err
+	}
+	return signedPlaintext(m, s.n, s.guard)
+}
+
+// DecryptInt64 decrypts a ciphertext in the same way as DecryptSigned and
+// returns ErrOverflow if the plaintext doesn't fit in an int64
+func (s SecretPaillier) DecryptInt64(c *Ciphertext) (int64, error) {
+	return plaintextInt64(s.DecryptSigned(c))
+}
+
+// WithGuardBand returns a copy of the key whose DecryptSigned rejects
+// the `width` plaintexts around n / 2, see signedPlaintext
+//
+// It returns ErrInvalidKey if width is negative or not smaller than n
+func (s SecretPaillier) WithGuardBand(width *big.Int) (SecretPaillier, error) {
+	if err := checkGuardBand(width, s.n); err != nil {
+		return SecretPaillier{}, err
+	}
+	s.guard = copyInt(width)
+	return s, nil
+}
+
+// decryptCRT computes
+//
+//	mp = L_p(c ** (p - 1) mod p ** 2) * hp mod p
+//	mq = L_q(c ** (q - 1) mod q ** 2) * hq mod q
+//
+// and returns m = mq + q * ((mp - mq) * q ** (-1) mod p), ok is false
+// if c ** (p - 1) is not 1 mod p or c ** (q - 1) is not 1 mod q
+func (s SecretPaillier) decryptCRT(c *big.Int) (m *big.Int, ok bool) {
+	xp := s.pCtxs.exp(c, subNew(s.p, oneInt), s.p.BitLen())
+	xq := s.qCtxs.exp(c, subNew(s.q, oneInt), s.q.BitLen())
+	lp, remP := nInt().QuoRem(subNew(xp, oneInt), s.p, nInt())
+	lq, remQ := nInt().QuoRem(subNew(xq, oneInt), s.q, nInt())
+	mp := bigMod(mulNew(lp, s.hp), s.p)
+	mq := bigMod(mulNew(lq, s.hq), s.q)
+	h := bigMod(mulNew(subNew(mp, mq), s.qInv), s.p)
+	m = addNew(mq, mulNew(s.q, h))
+	return m, remP.Sign() == 0 && remQ.Sign() == 0
 }
 
 // MulUint64 multiplies one ciphertext with a uint64 plaintext
+//
+// It panics if the ciphertext was produced by another key, see MulUint64E
 func (p PublicPaillier) MulUint64(a *Ciphertext, b uint64) *Ciphertext {
-	return &Ciphertext{num: powModUint64(a.num, b, p.n2)}
+	return mustCiphertext(p.MulUint64E(a, b))
+}
+
+// MulUint64E multiplies one ciphertext with a uint64 plaintext in the
+// same way as MulUint64 but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicPaillier) MulUint64E(a *Ciphertext, b uint64) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.exp(nInt(), a.num, nIntSetUint64(b), 64, nil), bind: p.bind}, nil
 }
 
 // MulInt64 multiplies one ciphertext with a int64 plaintext
+//
+// It panics if the ciphertext was produced by another key, see MulInt64E
 func (p PublicPaillier) MulInt64(a *Ciphertext, b int64) *Ciphertext {
 	return p.MulInt(a, nIntSetInt64(b))
 }
 
+// MulInt64E multiplies one ciphertext with a int64 plaintext in the
+// same way as MulInt64 but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicPaillier) MulInt64E(a *Ciphertext, b int64) (*Ciphertext, error) {
+	return p.MulIntE(a, nIntSetInt64(b))
+}
+
 // MulInt multiplies one ciphertext with a plaintext of arbitrary size
+//
+// It panics if the ciphertext was produced by another key, see MulIntE
 func (p PublicPaillier) MulInt(a *Ciphertext, b *big.Int) *Ciphertext {
-	if a.num.Sign() < 0 {
-		return &Ciphertext{num: powMod(invMod(a.num, p.n2), nInt().Abs(b), p.n2)}
+	return mustCiphertext(p.MulIntE(a, b))
+}
+
+// MulIntE multiplies one ciphertext with a plaintext of arbitrary size in
+// the same way as MulInt but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+//
+// The plaintext is taken mod n so a negative b becomes n - |b| and
+// the ciphertext never has to be inverted
+func (p PublicPaillier) MulIntE(a *Ciphertext, b *big.Int) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
 	}
-	return &Ciphertext{num: powMod(a.num, b, p.n2)}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Exp(nInt(), a.num, nInt().Mod(b, p.n)), bind: p.bind}, nil
 }
 
 // Add adds two ciphertexts
 //
 // In Paillier cryptosystem addition is the same as multiplication
 // over ciphertexts
+//
+// It panics if the ciphertexts were produced by another key, see AddE
 func (p PublicPaillier) Add(a, b *Ciphertext) *Ciphertext {
-	return &Ciphertext{num: bigMod(mulNew(a.num, b.num), p.n2)}
+	return mustCiphertext(p.AddE(a, b))
+}
+
+// AddE adds two ciphertexts in the same way as Add but returns
+// ErrKeyMismatch if any of them was produced by another key
+func (p PublicPaillier) AddE(a, b *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, a, b); err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(nInt(), a.num, b.num), bind: p.bind}, nil
+}
+
+// Sub subtracts the ciphertext b from a
+//
+// b is inverted modulo n ** 2 instead of being raised to the power -1, which
+// costs a gcd instead of an exponentiation
+//
+// It panics if the ciphertexts were produced by another key, see SubE
+func (p PublicPaillier) Sub(a, b *Ciphertext) *Ciphertext {
+	return mustCiphertext(p.SubE(a, b))
+}
+
+// SubE subtracts two ciphertexts in the same way as Sub but returns
+// ErrKeyMismatch if any of them was produced by another key and
+// ErrInvalidCiphertext if b isn't invertible
+func (p PublicPaillier) SubE(a, b *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, a, b); err != nil {
+		return nil, err
+	}
+	bInv, err := invertCiphertext(b, p.n2)
+	if err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(bInv, bInv, a.num), bind: p.bind}, nil
+}
+
+// Neg returns a ciphertext of the opposite of the plaintext of a
+//
+// It panics if the ciphertext was produced by another key, see NegE
+func (p PublicPaillier) Neg(a *Ciphertext) *Ciphertext {
+	return mustCiphertext(p.NegE(a))
+}
+
+// NegE negates a ciphertext in the same way as Neg but returns
+// ErrKeyMismatch if it was produced by another key and
+// ErrInvalidCiphertext if it isn't invertible
+func (p PublicPaillier) NegE(a *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
+	}
+	inv, err := invertCiphertext(a, p.n2)
+	if err != nil {
+		return nil, err
+	}
+	return &Ciphertext{num: inv, bind: p.bind}, nil
+}
+
+// AddPlainUint64 adds a uint64 plaintext to a ciphertext
+//
+// It panics if the ciphertext was produced by another key, see
+// AddPlainUint64E
+func (p PublicPaillier) AddPlainUint64(a *Ciphertext, m uint64) *Ciphertext {
+	return mustCiphertext(p.AddPlainUint64E(a, m))
+}
+
+// AddPlainUint64E adds a uint64 plaintext to a ciphertext in the same way
+// as AddPlainUint64 but returns ErrKeyMismatch if the ciphertext was
+// produced by another key
+func (p PublicPaillier) AddPlainUint64E(a *Ciphertext, m uint64) (*Ciphertext, error) {
+	return p.AddPlainIntE(a, nIntSetUint64(m))
+}
+
+// AddPlainInt adds a plaintext of arbitrary size to a ciphertext
+//
+// The ciphertext is multiplied by g ** m, which is 1 + m * n with
+// g = n + 1, and gets no fresh randomness so it can be linked to a,
+// see Rerandomize
+//
+// It panics if the ciphertext was produced by another key, see
+// AddPlainIntE
+func (p PublicPaillier) AddPlainInt(a *Ciphertext, m *big.Int) *Ciphertext {
+	return mustCiphertext(p.AddPlainIntE(a, m))
+}
+
+// AddPlainIntE adds a plaintext of arbitrary size to a ciphertext in the
+// same way as AddPlainInt but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicPaillier) AddPlainIntE(a *Ciphertext, m *big.Int) (*Ciphertext, error) {
+	if err := checkOperands(p, a); err != nil {
+		return nil, err
+	}
+	gm := p.gPow(m)
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(gm, gm, a.num), bind: p.bind}, nil
+}
+
+// SubPlainUint64 subtracts a uint64 plaintext from a ciphertext
+//
+// It panics if the ciphertext was produced by another key, see
+// SubPlainUint64E
+func (p PublicPaillier) SubPlainUint64(a *Ciphertext, m uint64) *Ciphertext {
+	return mustCiphertext(p.SubPlainUint64E(a, m))
+}
+
+// SubPlainUint64E subtracts a uint64 plaintext from a ciphertext in the
+// same way as SubPlainUint64 but returns ErrKeyMismatch if the ciphertext
+// was produced by another key
+func (p PublicPaillier) SubPlainUint64E(a *Ciphertext, m uint64) (*Ciphertext, error) {
+	return p.AddPlainIntE(a, nInt().Neg(nIntSetUint64(m)))
+}
+
+// SubPlainInt subtracts a plaintext of arbitrary size from a ciphertext
+//
+// It panics if the ciphertext was produced by another key, see
+// SubPlainIntE
+func (p PublicPaillier) SubPlainInt(a *Ciphertext, m *big.Int) *Ciphertext {
+	return mustCiphertext(p.SubPlainIntE(a, m))
+}
+
+// SubPlainIntE subtracts a plaintext of arbitrary size from a ciphertext
+// in the same way as SubPlainInt but returns ErrKeyMismatch if the
+// ciphertext was produced by another key
+func (p PublicPaillier) SubPlainIntE(a *Ciphertext, m *big.Int) (*Ciphertext, error) {
+	return p.AddPlainIntE(a, nInt().Neg(m))
+}
+
+// Rerandomize returns a ciphertext of the same plaintext as c that can't
+// be linked to it, c * r ** n mod (n ** 2) for a fresh r
+//
+// It panics if the ciphertext was produced by another key or if the
+// entropy source fails, see RerandomizeE
+func (p PublicPaillier) Rerandomize(c *Ciphertext) *Ciphertext {
+	return mustCiphertext(p.RerandomizeE(c))
+}
+
+// RerandomizeE rerandomizes a ciphertext in the same way as Rerandomize
+// but returns ErrKeyMismatch if it was produced by another key and
+// ErrEntropy if the entropy source fails
+func (p PublicPaillier) RerandomizeE(c *Ciphertext) (*Ciphertext, error) {
+	if err := checkOperands(p, c); err != nil {
+		return nil, err
+	}
+	rn, err := p.nonce()
+	if err != nil {
+		return nil, err
+	}
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(rn, rn, c.num), bind: p.bind}, nil
 }
 
 // EncryptUint64 encrypt a single uint64 integer
 // using the formula (g ** m) * (r ** n) mod (n ** 2)
 // where r is a chosen randomly
+//
+// It panics if the entropy source fails, see EncryptUint64E
 func (p PublicPaillier) EncryptUint64(m uint64) *Ciphertext {
-	gm := powModUint64(p.g, m, p.n2)
-	rn := powMod(p.randInt(), p.n, p.n2)
-	return &Ciphertext{num: bigMod(mulNew(gm, rn), p.n2)}
+	return mustCiphertext(p.EncryptUint64E(m))
+}
+
+// EncryptUint64E encrypts a single uint64 integer in the same way as
+// EncryptUint64 but returns ErrEntropy if the entropy source fails
+func (p PublicPaillier) EncryptUint64E(m uint64) (*Ciphertext, error) {
+	rn, err := p.nonce()
+	if err != nil {
+		return nil, err
+	}
+	gm := p.gPow(nIntSetUint64(m))
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(gm, gm, rn), bind: p.bind}, nil
 }
 
 // EncryptInt encrypts a single integer of arbitrary size
+//
+// It panics if the entropy source fails, see EncryptIntE
 func (p PublicPaillier) EncryptInt(m *big.Int) *Ciphertext {
-	var gm *big.Int
-	if m.Sign() >= 0 {
-		gm = powMod(p.g, m, p.n2)
-	} else {
-		gm = powMod(p.gInv, nInt().Abs(m), p.n2)
+	return mustCiphertext(p.EncryptIntE(m))
+}
+
+// EncryptIntE encrypts a single integer of arbitrary size in the same way
+// as EncryptInt but returns ErrEntropy if the entropy source fails
+func (p PublicPaillier) EncryptIntE(m *big.Int) (*Ciphertext, error) {
+	rn, err := p.nonce()
+	if err != nil {
+		return nil, err
 	}
-	rn := powMod(p.randInt(), p.n, p.n2)
-	return &Ciphertext{num: bigMod(mulNew(gm, rn), p.n2)}
+	gm := p.gPow(m)
+	ctx := p.modCtx()
+	defer p.release(ctx)
+	return &Ciphertext{num: ctx.Mul(gm, gm, rn), bind: p.bind}, nil
 }
 
 // EncryptInt64 encrypts a single int64 integer
+//
+// It panics if the entropy source fails, see EncryptInt64E
 func (p PublicPaillier) EncryptInt64(m int64) *Ciphertext {
 	return p.EncryptInt(nIntSetInt64(m))
 }
+
+// EncryptInt64E encrypts a single int64 integer in the same way as
+// EncryptInt64 but returns ErrEntropy if the entropy source fails
+func (p PublicPaillier) EncryptInt64E(m int64) (*Ciphertext, error) {
+	return p.EncryptIntE(nIntSetInt64(m))
+}
@@ -0,0 +1,170 @@
+package phe
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+)
+
+const (
+	paillierPublicKeyPEMType  = "PAILLIER PUBLIC KEY"
+	paillierPrivateKeyPEMType = "PAILLIER PRIVATE KEY"
+)
+
+// paillierPublicKey is the ASN.1 structure of a Paillier public key
+//
+//	PaillierPublicKey ::= SEQUENCE {
+//	    n            INTEGER,
+//	    g            INTEGER,
+//	    h            INTEGER OPTIONAL, -- short exponent mode
+//	    exponentBits INTEGER OPTIONAL  -- short exponent mode
+//	}
+type paillierPublicKey struct {
+	N            *big.Int
+	G            *big.Int
+	H            *big.Int `asn1:"optional"`
+	ExponentBits int      `asn1:"optional"`
+}
+
+// paillierPrivateKey is the ASN.1 structure of a Paillier private key,
+// similar to the PKCS #1 RSA private key
+//
+//	PaillierPrivateKey ::= SEQUENCE {
+//	    version INTEGER,
+//	    n       INTEGER,
+//	    g       INTEGER,
+//	    lambda  INTEGER,
+//	    phi     INTEGER,
+//	    p       INTEGER,
+//	    q       INTEGER
+//	}
+type paillierPrivateKey struct {
+	Version int
+	N       *big.Int
+	G       *big.Int
+	Lambda  *big.Int
+	Phi     *big.Int
+	P       *big.Int
+	Q       *big.Int
+}
+
+const paillierPrivateKeyVersion = 0
+
+// MarshalPaillierPublicKeyDER encodes the public key as an ASN.1 DER
+// PaillierPublicKey structure
+func MarshalPaillierPublicKeyDER(p PublicPaillier) ([]byte, error) {
+	return asn1.Marshal(paillierPublicKey{N: p.n, G: p.g, H: p.h, ExponentBits: p.shortBits})
+}
+
+// ParsePaillierPublicKeyDER decodes a public key encoded by
+// MarshalPaillierPublicKeyDER
+func ParsePaillierPublicKeyDER(der []byte) (PublicPaillier, error) {
+	var k paillierPublicKey
+	if err := unmarshalDER(der, &k); err != nil {
+		return PublicPaillier{}, err
+	}
+	if k.H != nil {
+		return newShortPublicPaillier(k.N, k.G, k.H, k.ExponentBits)
+	}
+	return newPublicPaillier(k.N, k.G)
+}
+
+// MarshalPaillierPrivateKeyDER encodes the secret key as an ASN.1 DER
+// PaillierPrivateKey structure
+func MarshalPaillierPrivateKeyDER(s SecretPaillier) ([]byte, error) {
+	return asn1.Marshal(paillierPrivateKey{
+		Version: paillierPrivateKeyVersion,
+		N:       s.n,
+		G:       s.g,
+		Lambda:  s.lambda,
+		Phi:     s.phi,
+		P:       s.p,
+		Q:       s.q,
+	})
+}
+
+// ParsePaillierPrivateKeyDER decodes a secret key encoded by
+// MarshalPaillierPrivateKeyDER
+func ParsePaillierPrivateKeyDER(der []byte) (SecretPaillier, error) {
+	var k paillierPrivateKey
+	if err := unmarshalDER(der, &k); err != nil {
+		return SecretPaillier{}, err
+	}
+	if k.Version != paillierPrivateKeyVersion {
+		return SecretPaillier{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidKey, k.Version)
+	}
+	s, err := newSecretPaillier(k.P, k.Q, k.G)
+	if err != nil {
+		return SecretPaillier{}, err
+	}
+	if s.n.Cmp(k.N) != 0 {
+		return SecretPaillier{}, fmt.Errorf("%w: p * q is not n", ErrInvalidKey)
+	}
+	return s, nil
+}
+
+// MarshalPaillierPublicKeyPEM encodes the public key as a
+// "PAILLIER PUBLIC KEY" PEM block holding its DER encoding
+func MarshalPaillierPublicKeyPEM(p PublicPaillier) ([]byte, error) {
+	der, err := MarshalPaillierPublicKeyDER(p)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: paillierPublicKeyPEMType, Bytes: der}), nil
+}
+
+// ParsePaillierPublicKeyPEM decodes the first "PAILLIER PUBLIC KEY"
+// PEM block of data
+func ParsePaillierPublicKeyPEM(data []byte) (PublicPaillier, error) {
+	der, err := decodePEM(data, paillierPublicKeyPEMType)
+	if err != nil {
+		return PublicPaillier{}, err
+	}
+	return ParsePaillierPublicKeyDER(der)
+}
+
+// MarshalPaillierPrivateKeyPEM encodes the secret key as a
+// "PAILLIER PRIVATE KEY" PEM block holding its DER encoding
+func MarshalPaillierPrivateKeyPEM(s SecretPaillier) ([]byte, error) {
+	der, err := MarshalPaillierPrivateKeyDER(s)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: paillierPrivateKeyPEMType, Bytes: der}), nil
+}
+
+// ParsePaillierPrivateKeyPEM decodes the first "PAILLIER PRIVATE KEY"
+// PEM block of data
+func ParsePaillierPrivateKeyPEM(data []byte) (SecretPaillier, error) {
+	der, err := decodePEM(data, paillierPrivateKeyPEMType)
+	if err != nil {
+		return SecretPaillier{}, err
+	}
+	return ParsePaillierPrivateKeyDER(der)
+}
+
+func unmarshalDER(der []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(der, v)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%w: trailing data after the ASN.1 structure", ErrInvalidKey)
+	}
+	return nil
+}
+
+// decodePEM returns the bytes of the first PEM block of type blockType
+func decodePEM(data []byte, blockType string) ([]byte, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%w: no %s PEM block found", ErrInvalidKey, blockType)
+		}
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+}
@@ -1,20 +1,22 @@
 package phe
 
 import (
-	cRand "crypto/rand"
+	"crypto/sha256"
+	"fmt"
 	pRand "github.com/reality95/cryptosystem/rand"
 	"math"
 	"math/big"
-	mRand "math/rand"
-	"sort"
 	"sync"
-	"time"
 )
 
 // Ciphertext is the encrypted form
 // over which all operations are done
+//
+// It remembers the scheme and the fingerprint of the public key that
+// produced it, the operations of another key refuse it with ErrKeyMismatch
 type Ciphertext struct {
-	num *big.Int
+	num  *big.Int
+	bind binding
 }
 
 // PublicKey for any phe cryptosystem must implement
@@ -23,20 +25,80 @@ type PublicKey interface {
 	EncryptUint64(uint64) *Ciphertext
 	EncryptInt64(int64) *Ciphertext
 	EncryptInt(*big.Int) *Ciphertext
+	EncryptUint64E(uint64) (*Ciphertext, error)
+	EncryptInt64E(int64) (*Ciphertext, error)
+	EncryptIntE(*big.Int) (*Ciphertext, error)
 	Add(*Ciphertext, *Ciphertext) *Ciphertext
 	MulUint64(*Ciphertext, uint64) *Ciphertext
 	MulInt64(*Ciphertext, int64) *Ciphertext
 	MulInt(*Ciphertext, *big.Int) *Ciphertext
+	AddE(*Ciphertext, *Ciphertext) (*Ciphertext, error)
+	MulUint64E(*Ciphertext, uint64) (*Ciphertext, error)
+	MulInt64E(*Ciphertext, int64) (*Ciphertext, error)
+	MulIntE(*Ciphertext, *big.Int) (*Ciphertext, error)
+	Sub(*Ciphertext, *Ciphertext) *Ciphertext
+	Neg(*Ciphertext) *Ciphertext
+	AddPlainUint64(*Ciphertext, uint64) *Ciphertext
+	AddPlainInt(*Ciphertext, *big.Int) *Ciphertext
+	SubPlainUint64(*Ciphertext, uint64) *Ciphertext
+	SubPlainInt(*Ciphertext, *big.Int) *Ciphertext
+	SubE(*Ciphertext, *Ciphertext) (*Ciphertext, error)
+	NegE(*Ciphertext) (*Ciphertext, error)
+	AddPlainUint64E(*Ciphertext, uint64) (*Ciphertext, error)
+	AddPlainIntE(*Ciphertext, *big.Int) (*Ciphertext, error)
+	SubPlainUint64E(*Ciphertext, uint64) (*Ciphertext, error)
+	SubPlainIntE(*Ciphertext, *big.Int) (*Ciphertext, error)
+	Rerandomize(*Ciphertext) *Ciphertext
+	RerandomizeE(*Ciphertext) (*Ciphertext, error)
+	Validate(*Ciphertext) error
+	PlaintextModulus() *big.Int
+	CiphertextModulus() *big.Int
+	SecurityBits() int
+	Fingerprint() [sha256.Size]byte
 	Copy() PublicKey
 }
 
+// boundKey is implemented by the public keys of the package, which bind
+// their ciphertexts to the scheme and know the moduli validating them.
+// Other implementations of PublicKey are checked through their Fingerprint
+// and Validate methods only
+type boundKey interface {
+	keyBinding() binding
+	validationModuli() (bound, n *big.Int)
+}
+
 // SecretKey for any phe cryptosystem much implement
 // the decryption
 type SecretKey interface {
 	Decrypt(*Ciphertext) *big.Int
+	DecryptE(*Ciphertext) (*big.Int, error)
+	DecryptSigned(*Ciphertext) (*big.Int, error)
+	DecryptInt64(*Ciphertext) (int64, error)
+	Fingerprint() [sha256.Size]byte
 	Copy() SecretKey
 }
 
+// securityBits returns the security level in bits of a modulus of nBits
+// bits following NIST SP 800-57, and the estimate of Lenstra and Verheul
+// for 512 bits. Smaller moduli are factored in practice
+func securityBits(nBits int) int {
+	switch {
+	case nBits >= 15360:
+		return 256
+	case nBits >= 7680:
+		return 192
+	case nBits >= 3072:
+		return 128
+	case nBits >= 2048:
+		return 112
+	case nBits >= 1024:
+		return 80
+	case nBits >= 512:
+		return 56
+	}
+	return 0
+}
+
 func gcd(a, b uint64) uint64 {
 	if b == 0 {
 		return a
@@ -44,7 +106,19 @@ func gcd(a, b uint64) uint64 {
 	return gcd(b, a%b)
 }
 
+// isProbablePrime checks small r exactly and the others with 32 rounds
+// of Miller-Rabin
+func isProbablePrime(r uint64) bool {
+	if r < 1<<30 {
+		return isPrime(r)
+	}
+	return nIntSetUint64(r).ProbablyPrime(32)
+}
+
 func isPrime(r uint64) bool {
+	if r < 2 {
+		return false
+	}
 	if r == 2 || r == 3 || r == 5 {
 		return true
 	}
@@ -70,139 +144,263 @@ func isPrime(r uint64) bool {
 	return true
 }
 
+// MinSecurity is the smallest size in bits of the primes accepted by the
+// GenerateKeys functions. GenNewKeysPaillier and GenNewKeysBenaloh still
+// accept smaller primes as they always did
+const MinSecurity = 256
+
+// checkSecurity reports ErrWeakParameters for primes shorter than
+// MinSecurity
+func checkSecurity(security int) error {
+	if security < MinSecurity {
+		return fmt.Errorf("%w: security must be at least %d bits", ErrWeakParameters, MinSecurity)
+	}
+	return nil
+}
+
 // GenNewKeysBenaloh generates a public and a secret Benaloh key such that
 // both primes are chosen randomly to have at most `security` bits
-func GenNewKeysBenaloh(r uint64, security int) (p PublicBenaloh, s SecretBenaloh) {
-	if r < 1<<30 {
-		for !isPrime(r) {
-			r++
-		}
-	} else {
-		for !nIntSetUint64(r).ProbablyPrime(32) {
-			r++
+//
+// Unless WithRandom is given, crypto/rand.Reader is used as the entropy source
+//
+// It panics if the keys can't be generated, GenerateKeysBenaloh returns
+// the error instead and also refuses primes shorter than MinSecurity
+func GenNewKeysBenaloh(r uint64, security int, opts ...Option) (p PublicBenaloh, s SecretBenaloh) {
+	factors, err := primeModulus(r)
+	if err == nil {
+		p, s, err = generateKeysBenaloh(factors, security, newKeyOptions(opts))
+	}
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// GenerateKeysBenaloh generates a public and a secret Benaloh key in the
+// same way as GenNewKeysBenaloh but reports ErrWeakParameters for a too
+// small or too large r or `security` and ErrEntropy if the entropy source
+// fails
+func GenerateKeysBenaloh(r uint64, security int, opts ...Option) (p PublicBenaloh, s SecretBenaloh, err error) {
+	if err = checkSecurity(security); err != nil {
+		return
+	}
+	factors, err := primeModulus(r)
+	if err != nil {
+		return
+	}
+	return generateKeysBenaloh(factors, security, newKeyOptions(opts))
+}
+
+// primeModulus returns the smallest prime r' >= r as the factorization of
+// the plaintext modulus
+func primeModulus(r uint64) ([]PrimePower, error) {
+	if r < 2 {
+		return nil, fmt.Errorf("%w: r must be at least 2", ErrWeakParameters)
+	}
+	for !isProbablePrime(r) {
+		if r == math.MaxUint64 {
+			return nil, fmt.Errorf("%w: no prime r fits in a uint64", ErrWeakParameters)
 		}
+		r++
 	}
+	return []PrimePower{{Prime: r, Exp: 1}}, nil
+}
+
+// GenNewKeysBenalohComposite generates a public and a secret Benaloh key
+// for the composite plaintext modulus r given by its factorization, such
+// as []PrimePower{{2, 32}} for r = 2 ** 32 or []PrimePower{{2, 128}} for a
+// plaintext space larger than the uint64 one
+//
+// The decryption finds the plaintext modulo every prime power factor of r
+// with a table of sqrt(prime) entries, so a smooth r gives a large
+// plaintext space with small decryption tables
+//
+// It panics if the keys can't be generated, GenerateKeysBenalohComposite
+// returns the error instead
+func GenNewKeysBenalohComposite(factors []PrimePower, security int, opts ...Option) (p PublicBenaloh, s SecretBenaloh) {
+	p, s, err := GenerateKeysBenalohComposite(factors, security, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
 
-	p.rn = mRand.New(mRand.NewSource(time.Now().UTC().UnixNano()))
+// GenerateKeysBenalohComposite generates a public and a secret Benaloh key
+// in the same way as GenNewKeysBenalohComposite but reports
+// ErrWeakParameters if the factors are not distinct primes with positive
+// exponents, if r has `security` / 2 bits or more, or for a too small
+// `security`, and ErrEntropy if the entropy source fails
+func GenerateKeysBenalohComposite(factors []PrimePower, security int, opts ...Option) (p PublicBenaloh, s SecretBenaloh, err error) {
+	if err = checkSecurity(security); err != nil {
+		return
+	}
+	return generateKeysBenaloh(factors, security, newKeyOptions(opts))
+}
+
+// generateKeysBenaloh generates the primes p1 and p2 of n = p1 * p2 such
+// that r | p2 - 1 with gcd(r, (p2 - 1) / r) = 1 and gcd(r, p1 - 1) is 1,
+// or 2 for an even r, as well as y such that y ** ((p2 - 1) / l) != 1
+// mod p2 for every prime l dividing r
+func generateKeysBenaloh(factors []PrimePower, security int, o keyOptions) (p PublicBenaloh, s SecretBenaloh, err error) {
+	// r | p2 - 1 gives away the low bits of p2 and n can be factored once
+	// half of the bits of p2 are known (Coppersmith), so r must stay
+	// shorter than that
+	r, err := plaintextModulus(factors, security/2-1)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrWeakParameters, err)
+		return
+	}
+
+	p.random = o.random
 	p.r = r
 	s.r = r
-	rBig := nIntSetUint64(r)
-	p.rBig = rBig
-	s.rBig = rBig
+	// gcd(r, p1 - 1) can't be 1 when both are even
+	wantGCD := nInt().GCD(nil, nil, r, nIntSetUint64(2))
 	var p1, p2, p1_1, p2_1 *big.Int
-	// Computing prime p1 such that (p1 - 1, r) = 1
+	// Computing prime p1 such that (p1 - 1, r) = 1, or 2 for an even r
 	for {
-		p1, _ = cRand.Prime(p.rn, security)
+		if p1, err = pRand.Prime(p.random, security, oneInt); err != nil {
+			err = entropyError{err}
+			return
+		}
 		p1_1 = subNew(p1, oneInt)
-		if nInt().GCD(nil, nil, p1_1, rBig).Cmp(oneInt) == 0 {
+		if nInt().GCD(nil, nil, p1_1, r).Cmp(wantGCD) == 0 {
 			break
 		}
 	}
 	// Computing prime p2 such that (p2 - 1, r) = r
 	for {
-		p2, _ = pRand.Prime(p.rn, security, r)
+		if p2, err = pRand.Prime(p.random, security, r); err != nil {
+			err = entropyError{err}
+			return
+		}
 		p2_1 = subNew(p2, oneInt)
-		rem := nInt().Div(p2_1, rBig)
-		if nInt().GCD(nil, nil, rem, rBig).Cmp(oneInt) == 0 {
+		rem := nInt().Div(p2_1, r)
+		if p2.Cmp(p1) != 0 && nInt().GCD(nil, nil, rem, r).Cmp(oneInt) == 0 {
 			break
 		}
 	}
 	p.n = mulNew(p1, p2)
 	s.n = p.n
-	s.phi = mulNew(p1_1, p2_1)       // phi(n) = (p1 - 1)(p2 - 1)
-	s.phiOverR = divNew(s.phi, rBig) // phi(n) / r
-	// Generate y such that y ** (phi(n) / r) != 1 mod n
+	s.phi = mulNew(p1_1, p2_1) // phi(n) = (p1 - 1)(p2 - 1)
+	s.p = p2
+	s.pOverR = divNew(p2_1, r) // (p2 - 1) / r
+	s.factors = newBenalohFactors(factors, r)
+	// Generate y such that y ** ((p2 - 1) / l) != 1 mod p2 for every l.
+	// With an even r the Jacobi symbol of a ciphertext mod n is the one of
+	// y ** m, which would give away m mod 2 unless the symbol of y is 1
+	even := r.Bit(0) == 0
 	for {
-		p.y, _ = cRand.Int(p.rn, p.n)
-		if p.y.Cmp(zeroInt) != 0 && powMod(p.y, s.phiOverR, p.n).Cmp(oneInt) != 0 {
+		if p.y, err = randomUnit(p.random, p.n); err != nil {
+			return
+		}
+		if (!even || big.Jacobi(p.y, p.n) == 1) && s.generates(p.y) {
 			break
 		}
 	}
 
 	p.yInv = invMod(p.y, p.n)
+	p.ctxs = newModContextPool(p.n)
 
-	sqrtR := uint64(math.Ceil(math.Sqrt(float64(r))))
-	s.sqrtR = sqrtR
-
-	s.xInvPowers = make([]*big.Int, sqrtR, sqrtR)
-	s.xSqrtPowers = make([]rootPower, sqrtR, sqrtR)
-
-	// x = y ** (phi(n) / r) mod n
-	// x is a root of order r modulo n
-	x := powMod(p.y, s.phiOverR, p.n)
-	// x ** (-1) mod n
-	xInv := invMod(x, p.n)
-	// x ** (sqrtR) mod n
-	xSqrtPower := powMod(x, nIntSetUint64(sqrtR), p.n)
-
-	s.xInvPowers[0] = nIntSetUint64(1)
-	s.xSqrtPowers[0] = rootPower{power: 0, num: nIntSetUint64(1)}
-
-	for i := uint64(1); i < sqrtR; i++ {
-		// x ** (-i) mod n
-		s.xInvPowers[i] = bigMod(mulNew(xInv, s.xInvPowers[i-1]), s.n)
-		// x ** (i * sqrtR) mod n
-		s.xSqrtPowers[i] = rootPower{power: i * sqrtR, num: bigMod(mulNew(xSqrtPower, s.xSqrtPowers[i-1].num), s.n)}
-	}
-
-	sort.Slice(s.xSqrtPowers, func(i, j int) bool {
-		return s.xSqrtPowers[i].num.Cmp(s.xSqrtPowers[j].num) < 0
-	})
+	s.y = p.y
+	s.precompute()
+	p.bind = newBinding(schemeBenaloh, p)
+	s.bind = p.bind
 
 	return
 }
 
 // GenNewKeysPaillier generates a public and a secret Paillier key such that
 // both primes are chosen randomly to have at most `security` bits
-func GenNewKeysPaillier(security int) (p PublicPaillier, s SecretPaillier) {
-	p.r = mRand.New(mRand.NewSource(time.Now().UTC().UnixNano()))
-	p1, _ := cRand.Prime(p.r, security)
-	p2, _ := cRand.Prime(p.r, security)
-	p.n = mulNew(p1, p2)
-	s.n = p.n
-	p.n2 = mulNew(p.n, p.n) // n ** 2
-	s.n2 = p.n2
-	p1_1 := subNew(p1, oneInt) // (p1 - 1)
-	p2_1 := subNew(p2, oneInt) // (p2 - 1)
-	s.phi = mulNew(p1_1, p2_1) // (p1 - 1) * (p2 - 1)
-	gcd := nInt().GCD(nil, nil, p1_1, p2_1)
-	s.lambda = divNew(s.phi, gcd) // (p1 - 1) * (p2 - 1) / gcd(p1 - 1, p2 - 1)
-	p.g = addNew(p.n, oneInt)     // n + 1 is a general prefference for g
-	p.gInv = invMod(p.g, p.n2)
-	s.mu = invMod(p.L(powMod(p.g, s.lambda, p.n2)), s.n) // mu = L(g ** lambda) ** (-1) mod n
-	return
-}
-
-// EncryptVectorUint64Fast reuses random numbers r in the encryption protocol
-// i.e. after picking a random r, we will take r[i] = r**(Random(0, 2^64 - 1))
-// then to encrypt msgs[i], we will take ans[i] = (g ** msgs[i]) * (r[i] ** n)
 //
-// So if for some reason, msgs[i] for some i is found out by a third party,
-// in the normal protocol, this doesn't leak any other msgs[j] for i != j,
-// in this version however upon finding msgs[i] for some i, it will be possible
-// to find all other msgs[j] using c * 2^64 tries.
+// The keys use g = n + 1 for which g ** m = 1 + m * n mod (n ** 2), so the
+// encryption only exponentiates the nonce
 //
-// In other words, the security of the whole vector in this case is the same
-// as the security for only one element in the general case
+// Unless WithRandom is given, crypto/rand.Reader is used as the entropy source
 //
-// This is not a part of the official protocol so use at your own risk
-func EncryptVectorUint64Fast(p PublicPaillier, msgs []uint64) (ans []*Ciphertext) {
-	N := len(msgs)
-	ans = make([]*Ciphertext, N, N)
-	rn := powMod(p.randInt(), p.n, p.n2)
-	for i, msg := range msgs {
-		ans[i].num = bigMod(mulNew(powModUint64(p.g, msg, p.n2), powModUint64(rn, p.r.Uint64(), p.n2)), p.n2)
+// It panics if the keys can't be generated, GenerateKeysPaillier returns
+// the error instead and also refuses primes shorter than MinSecurity
+func GenNewKeysPaillier(security int, opts ...Option) (p PublicPaillier, s SecretPaillier) {
+	p, s, err := generateKeysPaillier(security, newKeyOptions(opts))
+	if err != nil {
+		panic(err)
 	}
 	return
 }
 
+// GenerateKeysPaillier generates a public and a secret Paillier key in the
+// same way as GenNewKeysPaillier but reports ErrWeakParameters for a too
+// small `security` and ErrEntropy if the entropy source fails
+func GenerateKeysPaillier(security int, opts ...Option) (p PublicPaillier, s SecretPaillier, err error) {
+	if err = checkSecurity(security); err != nil {
+		return
+	}
+	return generateKeysPaillier(security, newKeyOptions(opts))
+}
+
+// generateKeysPaillier generates the keys without checking `security`
+// against MinSecurity
+func generateKeysPaillier(security int, o keyOptions) (p PublicPaillier, s SecretPaillier, err error) {
+	p.random = o.random
+	var p1, p2 *big.Int
+	if p1, err = pRand.Prime(p.random, security, oneInt); err != nil {
+		err = entropyError{err}
+		return
+	}
+	// p1 == p2 would make n a square which is trivial to factor
+	for p2 == nil || p2.Cmp(p1) == 0 {
+		if p2, err = pRand.Prime(p.random, security, oneInt); err != nil {
+			err = entropyError{err}
+			return
+		}
+	}
+	p.n = mulNew(p1, p2)
+	p.n2 = mulNew(p.n, p.n)   // n ** 2
+	p.g = addNew(p.n, oneInt) // n + 1 is a general prefference for g
+	p.fastG = true
+	p.ctxs = newModContextPool(p.n2)
+	if o.shortExponent {
+		// h = -x ** 2 mod n
+		var x *big.Int
+		if x, err = p.randInt(); err != nil {
+			return
+		}
+		h := subNew(p.n, bigMod(mulNew(x, x), p.n))
+		p.setShortExponent(h, shortExponentBits(p.n.BitLen()))
+	}
+	p.bind = paillierBinding(p.n, p.g)
+	// lambda, mu and the CRT values are computed from the primes
+	s, err = newSecretPaillier(p1, p2, p.g)
+	return
+}
+
 // EncryptVectorUint64 encrypts a vector of uint64 messages
 // performing p.Encrypt for every message in the vector
-func EncryptVectorUint64(p PublicKey, msgs []uint64) (ans []*Ciphertext) {
+//
+// It panics if a message isn't smaller than p.PlaintextModulus(), which
+// would wrap around, or if the entropy source fails, see
+// EncryptVectorUint64E
+func EncryptVectorUint64(p PublicKey, msgs []uint64) []*Ciphertext {
+	ans, err := EncryptVectorUint64E(p, msgs)
+	if err != nil {
+		panic(err)
+	}
+	return ans
+}
+
+// EncryptVectorUint64E encrypts a vector of uint64 messages in the same
+// way as EncryptVectorUint64 but returns ErrOverflow if a message would
+// wrap around and stops at the first error
+func EncryptVectorUint64E(p PublicKey, msgs []uint64) (ans []*Ciphertext, err error) {
+	if err = checkPlaintextsUint64(p, msgs); err != nil {
+		return nil, err
+	}
 	N := len(msgs)
 	ans = make([]*Ciphertext, N, N)
 	for i, msg := range msgs {
-		ans[i] = p.EncryptUint64(msg)
+		if ans[i], err = p.EncryptUint64E(msg); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
 	}
 	return
 }
@@ -210,7 +408,12 @@ func EncryptVectorUint64(p PublicKey, msgs []uint64) (ans []*Ciphertext) {
 // EncryptVectorUint64Parallel encrypts a vector of uint64 messages
 // performing p.Encrypt for every message in the vector and using
 // at most maxProcs go routines
+//
+// Like EncryptVectorUint64 it panics if a message would wrap around
 func EncryptVectorUint64Parallel(p PublicKey, msgs []uint64, maxProcs uint64) (ans []*Ciphertext) {
+	if err := checkPlaintextsUint64(p, msgs); err != nil {
+		panic(err)
+	}
 	N := uint64(len(msgs))
 	ans = make([]*Ciphertext, N, N)
 	B := uint64(N+maxProcs-1) / maxProcs
@@ -231,6 +434,56 @@ func EncryptVectorUint64Parallel(p PublicKey, msgs []uint64, maxProcs uint64) (a
 	return
 }
 
+// checkPlaintextsUint64 returns ErrOverflow if a message isn't smaller
+// than the plaintext modulus of p
+func checkPlaintextsUint64(p PublicKey, msgs []uint64) error {
+	mod := p.PlaintextModulus()
+	if !mod.IsUint64() {
+		return nil
+	}
+	for i, msg := range msgs {
+		if msg >= mod.Uint64() {
+			return fmt.Errorf("message %d: %w: %d doesn't fit in the plaintext space", i, ErrOverflow, msg)
+		}
+	}
+	return nil
+}
+
+// RerandomizeVector rerandomizes a vector of ciphertexts using
+// p.Rerandomize on every ciphertext in the vector
+func RerandomizeVector(p PublicKey, v []*Ciphertext) (ans []*Ciphertext) {
+	N := len(v)
+	ans = make([]*Ciphertext, N, N)
+	for i, c := range v {
+		ans[i] = p.Rerandomize(c)
+	}
+	return
+}
+
+// RerandomizeVectorParallel rerandomizes a vector of ciphertexts using
+// p.Rerandomize on every ciphertext in the vector and using at most
+// maxProcs go routines
+func RerandomizeVectorParallel(p PublicKey, v []*Ciphertext, maxProcs uint64) (ans []*Ciphertext) {
+	N := uint64(len(v))
+	ans = make([]*Ciphertext, N, N)
+	B := uint64(N+maxProcs-1) / maxProcs
+	var wg sync.WaitGroup
+	rerandomizeSlice := func(vSlice []*Ciphertext, ansSlice []*Ciphertext, pk PublicKey) {
+		defer wg.Done()
+		for i, c := range vSlice {
+			ansSlice[i] = pk.Rerandomize(c)
+		}
+	}
+	for w := uint64(0); w*B < N; w++ {
+		leftSliceBound := w * B
+		rightSliceBound := min(w*B+B, N)
+		wg.Add(1)
+		go rerandomizeSlice(v[leftSliceBound:rightSliceBound], ans[leftSliceBound:rightSliceBound], p.Copy())
+	}
+	wg.Wait()
+	return
+}
+
 // DecryptVector decrypts a vector of ciphertexts using
 // s.Decrypt method on every ciphertext in the vector
 func DecryptVector(s SecretKey, v []*Ciphertext) (ans []*big.Int) {
@@ -242,6 +495,19 @@ func DecryptVector(s SecretKey, v []*Ciphertext) (ans []*big.Int) {
 	return
 }
 
+// DecryptVectorE decrypts a vector of ciphertexts using s.DecryptE
+// method on every ciphertext in the vector and stops at the first error
+func DecryptVectorE(s SecretKey, v []*Ciphertext) (ans []*big.Int, err error) {
+	N := len(v)
+	ans = make([]*big.Int, N, N)
+	for i := 0; i < N; i++ {
+		if ans[i], err = s.DecryptE(v[i]); err != nil {
+			return nil, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+	}
+	return
+}
+
 // DecryptVectorParallel decrypts a vector of ciphertexts using
 // s.Decrypt method on every ciphertext in the vector using
 // at most maxProcs go routines
@@ -266,6 +532,13 @@ func DecryptVectorParallel(s SecretKey, v []*Ciphertext, maxProcs uint64) (ans [
 	return
 }
 
+func mustCiphertext(c *Ciphertext, err error) *Ciphertext {
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
 func min(a, b uint64) uint64 {
 	if a < b {
 		return a
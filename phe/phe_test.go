@@ -1,7 +1,9 @@
 package phe
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"math"
 	"math/big"
 	"math/rand"
 	"runtime"
@@ -25,13 +27,16 @@ func TestBasicOperation(t *testing.T) {
 	t.Run("Paillier", getBasicOperationSubtest(s1, p1))
 	t.Run("Benaloh", getBasicOperationSubtest(s2, p2))
 	modBenaloh := p2.GetPlaintextMod()
-	assert.Equal(t, int64(modBenaloh-69), s2.Decrypt(p2.EncryptInt64(-69)).Int64())
+	assert.Equal(t, modBenaloh.Int64()-69, s2.Decrypt(p2.EncryptInt64(-69)).Int64())
+	m, err := s2.DecryptInt64(p2.EncryptInt64(-69))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-69), m)
 }
 
 func TestPlaintextModuloBenaloh(t *testing.T) {
 	assert := assert.New(t)
 	p, s := GenNewKeysBenaloh(1000000000, 2048)
-	mod := int64(p.GetPlaintextMod())
+	mod := p.GetPlaintextMod().Int64()
 	xCipher := p.EncryptUint64(0)
 	xPlain := int64(0)
 	for op := 0; op < 256; op++ {
@@ -111,3 +116,374 @@ func TestVector(t *testing.T) {
 	t.Run("Paillier", getVectorSubtest(s1, p1, a1, b1, N1))
 	t.Run("Benaloh", getVectorSubtest(s2, p2, a2, b2, N2))
 }
+
+func getRerandomizeSubtest(s SecretKey, p, other PublicKey) func(*testing.T) {
+	return func(t *testing.T) {
+		assert := assert.New(t)
+		c := p.Add(p.EncryptUint64(13), p.EncryptUint64(56))
+		r := p.Rerandomize(c)
+		assert.NotEqual(c.num, r.num, "Expected a fresh ciphertext")
+		assert.Equal(uint64(69), s.Decrypt(r).Uint64())
+		assert.Nil(p.Validate(r))
+		v := EncryptVectorUint64(p, []uint64{1, 2, 3, 4, 5})
+		for _, w := range [][]*Ciphertext{RerandomizeVector(p, v), RerandomizeVectorParallel(p, v, 2)} {
+			for i := range v {
+				assert.NotEqual(v[i].num, w[i].num, "Expected a fresh ciphertext")
+			}
+			assert.Equal(DecryptVector(s, v), DecryptVector(s, w))
+		}
+		_, err := other.RerandomizeE(c)
+		assert.True(errors.Is(err, ErrKeyMismatch), "Expected a key mismatch for another key")
+	}
+}
+
+func TestRerandomize(t *testing.T) {
+	p1, s1 := GenNewKeysPaillier(512)
+	p2, s2 := GenNewKeysBenaloh(1009, 512)
+	o1, _ := GenNewKeysPaillier(512)
+	o2, _ := GenNewKeysBenaloh(1009, 512)
+	t.Run("Paillier", getRerandomizeSubtest(s1, p1, o1))
+	t.Run("Benaloh", getRerandomizeSubtest(s2, p2, o2))
+	c := p1.EncryptUint64(1)
+	p1.random = failingReader{}
+	_, err := p1.RerandomizeE(c)
+	assert.True(t, errors.Is(err, ErrEntropy), "Expected an entropy error for a failing reader")
+}
+
+func getSubtractionSubtest(s SecretKey, p, other PublicKey, mod *big.Int) func(*testing.T) {
+	return func(t *testing.T) {
+		assert := assert.New(t)
+		signed := func(c *Ciphertext) int64 {
+			m := s.Decrypt(c)
+			if m.Cmp(divNew(mod, nIntSetUint64(2))) > 0 {
+				m.Sub(m, mod)
+			}
+			return m.Int64()
+		}
+		a, b := p.EncryptUint64(69), p.EncryptUint64(13)
+		assert.Equal(int64(56), signed(p.Sub(a, b)))
+		assert.Equal(int64(-56), signed(p.Sub(b, a)))
+		assert.Equal(int64(-69), signed(p.Neg(a)))
+		assert.Equal(int64(69), signed(p.Neg(p.Neg(a))))
+		assert.Equal(int64(69+420), signed(p.AddPlainUint64(a, 420)))
+		assert.Equal(int64(69-420), signed(p.AddPlainInt(a, nIntSetInt64(-420))))
+		assert.Equal(int64(69-420), signed(p.SubPlainUint64(a, 420)))
+		assert.Equal(int64(69+420), signed(p.SubPlainInt(a, nIntSetInt64(-420))))
+		assert.Equal(int64(69-13*3), signed(p.Add(a, p.MulInt64(b, -3))))
+		assert.Equal(int64(69), signed(p.AddPlainInt(a, mod)))
+
+		_, err := p.SubE(a, other.EncryptUint64(1))
+		assert.True(errors.Is(err, ErrKeyMismatch), "Expected a key mismatch for another key")
+		_, err = other.AddPlainUint64E(a, 1)
+		assert.True(errors.Is(err, ErrKeyMismatch), "Expected a key mismatch for another key")
+		_, err = p.NegE(nil)
+		assert.True(errors.Is(err, ErrInvalidCiphertext))
+	}
+}
+
+func TestSubtraction(t *testing.T) {
+	p1, s1 := GenNewKeysPaillier(512)
+	p2, s2 := GenNewKeysBenaloh(1009, 512)
+	o1, _ := GenNewKeysPaillier(512)
+	o2, _ := GenNewKeysBenaloh(1009, 512)
+	t.Run("Paillier", getSubtractionSubtest(s1, p1, o1, s1.n))
+	t.Run("Benaloh", getSubtractionSubtest(s2, p2, o2, p2.r))
+	t.Run("BenalohTables", getSubtractionSubtest(s2, p2.WithEncryptionTables(), o2, p2.r))
+
+	// n isn't invertible mod n ** 2
+	_, err := p1.NegE(&Ciphertext{num: p1.n, bind: p1.bind})
+	assert.True(t, errors.Is(err, ErrInvalidCiphertext), "Expected a non invertible ciphertext to be rejected")
+}
+
+func TestModuli(t *testing.T) {
+	assert := assert.New(t)
+	p1, _ := GenNewKeysPaillier(512)
+	p2, _ := GenNewKeysBenaloh(1009, 512)
+	for _, p := range []PublicKey{p1, p2} {
+		assert.Equal(80, p.SecurityBits())
+		// the moduli are copies
+		p.PlaintextModulus().SetInt64(1)
+		p.CiphertextModulus().SetInt64(1)
+	}
+	assert.Equal(p1.n, p1.PlaintextModulus())
+	assert.Equal(p1.n2, p1.CiphertextModulus())
+	assert.Equal(nIntSetUint64(1009), p2.PlaintextModulus())
+	assert.Equal(p2.n, p2.CiphertextModulus())
+	assert.Equal(56, securityBits(512))
+	assert.Equal(112, securityBits(2048))
+	assert.Equal(0, securityBits(256))
+
+	_, err := EncryptVectorUint64E(p2, []uint64{1, 1008, 1009})
+	assert.True(errors.Is(err, ErrOverflow), "Expected r not to fit in the plaintext space")
+	assert.Panics(func() { EncryptVectorUint64(p2, []uint64{1 << 40}) })
+	assert.Panics(func() { EncryptVectorUint64Parallel(p2, []uint64{1 << 40}, 2) })
+	_, err = EncryptVectorUint64E(p1, []uint64{1<<64 - 1})
+	assert.Nil(err)
+}
+
+func TestWithRandom(t *testing.T) {
+	p1, _ := GenNewKeysPaillier(256, WithRandom(rand.New(rand.NewSource(42))))
+	p2, _ := GenNewKeysPaillier(256, WithRandom(rand.New(rand.NewSource(42))))
+	assert.Equal(t, p1.n, p2.n, "Expected the same key for the same entropy source")
+	b1, _ := GenNewKeysBenaloh(1009, 256, WithRandom(rand.New(rand.NewSource(42))))
+	b2, _ := GenNewKeysBenaloh(1009, 256, WithRandom(rand.New(rand.NewSource(42))))
+	assert.Equal(t, b1.n, b2.n, "Expected the same key for the same entropy source")
+	assert.Equal(t, b1.y, b2.y, "Expected the same key for the same entropy source")
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("no entropy left")
+}
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, _, err := GenerateKeysPaillier(64)
+	assert.True(errors.Is(err, ErrWeakParameters), "Expected weak parameters for a small security")
+	_, _, err = GenerateKeysBenaloh(1009, 64)
+	assert.True(errors.Is(err, ErrWeakParameters), "Expected weak parameters for a small security")
+	_, _, err = GenerateKeysBenaloh(1, 512)
+	assert.True(errors.Is(err, ErrWeakParameters), "Expected weak parameters for r = 1")
+	_, _, err = GenerateKeysBenaloh(math.MaxUint64-10, 512)
+	assert.True(errors.Is(err, ErrWeakParameters), "Expected weak parameters when no prime r fits in a uint64")
+	_, _, err = GenerateKeysPaillier(512, WithRandom(failingReader{}))
+	assert.True(errors.Is(err, ErrEntropy), "Expected an entropy error for a failing reader")
+
+	// the legacy functions keep accepting small primes
+	pl, sl := GenNewKeysPaillier(64)
+	assert.Equal(uint64(69), sl.Decrypt(pl.EncryptUint64(69)).Uint64())
+	pb, sb := GenNewKeysBenaloh(1009, 64)
+	assert.Equal(uint64(69), sb.Decrypt(pb.EncryptUint64(69)).Uint64())
+
+	p1, s1, err := GenerateKeysPaillier(512)
+	assert.Nil(err)
+	p2, s2, err := GenerateKeysBenaloh(1009, 512)
+	assert.Nil(err)
+	for _, s := range []SecretKey{s1, s2} {
+		_, err = s.DecryptE(nil)
+		assert.True(errors.Is(err, ErrInvalidCiphertext))
+		_, err = s.DecryptE(&Ciphertext{num: nIntSetUint64(0)})
+		assert.True(errors.Is(err, ErrInvalidCiphertext))
+	}
+	_, err = s1.DecryptE(&Ciphertext{num: p1.n2})
+	assert.True(errors.Is(err, ErrInvalidCiphertext))
+	_, err = s2.DecryptE(&Ciphertext{num: p2.n})
+	assert.True(errors.Is(err, ErrInvalidCiphertext))
+	_, err = s1.DecryptE(&Ciphertext{num: p1.n})
+	assert.True(errors.Is(err, ErrDecryptionFailed), "Expected n not to decrypt under Paillier")
+
+	m, err := s1.DecryptE(p1.EncryptUint64(69))
+	assert.Nil(err)
+	assert.Equal(uint64(69), m.Uint64())
+	m, err = s2.DecryptE(p2.EncryptUint64(69))
+	assert.Nil(err)
+	assert.Equal(uint64(69), m.Uint64())
+
+	p1.random = failingReader{}
+	_, err = p1.EncryptUint64E(69)
+	assert.True(errors.Is(err, ErrEntropy), "Expected an entropy error for a failing reader")
+	_, err = EncryptVectorUint64E(p1, []uint64{1, 2})
+	assert.True(errors.Is(err, ErrEntropy), "Expected an entropy error for a failing reader")
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	p1, s1 := GenNewKeysPaillier(512)
+	p2, s2 := GenNewKeysBenaloh(1009, 512)
+	for _, key := range []struct {
+		p   PublicKey
+		phi *big.Int
+	}{{p1, s1.phi}, {p2, s2.phi}} {
+		p := key.p
+		bound, n := p.(boundKey).validationModuli()
+		v := EncryptVectorUint64(p, []uint64{1, 2, 3, 4})
+		assert.Nil(p.Validate(v[0]))
+		assert.Nil(ValidateVector(p, v))
+		for _, num := range []*big.Int{nIntSetUint64(0), bound, addNew(bound, oneInt)} {
+			c := &Ciphertext{num: num, bind: p.(boundKey).keyBinding()}
+			assert.True(errors.Is(p.Validate(c), ErrInvalidCiphertext), "Expected %v to be out of range", num)
+		}
+		// A multiple of a prime factor of n is in range but not coprime with n
+		factor, _ := paillierFactors(n, key.phi)
+		v[2] = &Ciphertext{num: mulNew(factor, nIntSetUint64(3)), bind: p.(boundKey).keyBinding()}
+		assert.True(errors.Is(p.Validate(v[2]), ErrInvalidCiphertext))
+		err := ValidateVector(p, v)
+		assert.True(errors.Is(err, ErrInvalidCiphertext))
+		assert.Contains(err.Error(), "ciphertext 2")
+
+		// PublicKey can be implemented outside of the package
+		w := wrappedKey{p}
+		err = ValidateVector(w, v)
+		assert.True(errors.Is(err, ErrInvalidCiphertext))
+		assert.Contains(err.Error(), "ciphertext 2")
+		data, _ := v[0].MarshalBinary()
+		_, err = UnmarshalCiphertext(w, data)
+		assert.Nil(err)
+		other, _ := GenNewKeysPaillier(512)
+		_, err = UnmarshalCiphertext(wrappedKey{other}, data)
+		assert.True(errors.Is(err, ErrKeyMismatch))
+	}
+}
+
+// wrappedKey only has the exported methods of PublicKey
+type wrappedKey struct {
+	PublicKey
+}
+
+// decryptLambda decrypts with the formula L(c ** lambda mod (n ** 2)) * mu
+// mod n directly to check and measure decryptCRT
+func decryptLambda(s SecretPaillier, c *big.Int) *big.Int {
+	return bigMod(mulNew(s.L(powModSecret(c, s.lambda, s.n2, s.n.BitLen())), s.mu), s.n)
+}
+
+func TestPaillierCRT(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysPaillier(512)
+	for i := 0; i < 16; i++ {
+		c := p.EncryptInt(nInt().Rand(rnd, p.n))
+		m, ok := s.decryptCRT(c.num)
+		assert.True(ok)
+		assert.Equal(decryptLambda(s, c.num), m)
+	}
+}
+
+func BenchmarkDecryptPaillier(b *testing.B) {
+	p, s := GenNewKeysPaillier(1024)
+	c := p.EncryptUint64(69)
+	b.Run("CRT", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.decryptCRT(c.num)
+		}
+	})
+	b.Run("Lambda", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decryptLambda(s, c.num)
+		}
+	})
+}
+
+func TestPaillierGenerator(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysPaillier(512)
+	assert.True(p.fastG)
+	for _, m := range []*big.Int{zeroInt, nIntSetUint64(69), nIntSetInt64(-69), subNew(p.n, oneInt), p.n2} {
+		want := powMod(p.g, nInt().Mod(m, p.n), p.n2)
+		assert.Equal(want, p.gPow(m), "Expected 1 + m * n for g = n + 1")
+	}
+
+	// g = (n + 1) ** 2 * 3 ** n is another valid generator
+	g := bigMod(mulNew(powMod(p.g, nIntSetUint64(2), p.n2), powMod(nIntSetUint64(3), p.n, p.n2)), p.n2)
+	p2, err := newPublicPaillier(p.n, g)
+	assert.Nil(err)
+	s2, err := newSecretPaillier(s.p, s.q, g)
+	assert.Nil(err)
+	assert.False(p2.fastG)
+	assert.Equal(uint64(69), s2.Decrypt(p2.EncryptUint64(69)).Uint64())
+	assert.Equal(subNew(p.n, nIntSetUint64(69)), s2.Decrypt(p2.EncryptInt64(-69)))
+	assert.Equal(subNew(p.n, nIntSetUint64(138)), s2.Decrypt(p2.MulInt64(p2.EncryptInt64(69), -2)))
+	assert.Equal(subNew(p.n, nIntSetUint64(138)), s.Decrypt(p.MulInt64(p.EncryptInt64(69), -2)))
+}
+
+func TestShortExponents(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysPaillier(512, WithShortExponents())
+	assert.Equal(160, p.shortBits)
+	// h = -x ** 2 mod n so -h is a square mod p and mod q
+	minusH := subNew(p.n, p.h)
+	assert.Equal(1, big.Jacobi(minusH, s.p))
+	assert.Equal(1, big.Jacobi(minusH, s.q))
+	hn := powMod(p.h, p.n, p.n2)
+	for _, a := range []*big.Int{zeroInt, oneInt, nInt().Rand(rnd, nInt().Lsh(oneInt, 160))} {
+		assert.Equal(powMod(hn, a, p.n2), p.hnTable.exp(a))
+	}
+	assert.Equal(int64(-69), nInt().Sub(s.Decrypt(p.EncryptInt64(-69)), s.n).Int64())
+	c := p.Copy().(PublicPaillier)
+	assert.True(c.hnTable == p.hnTable, "Expected the copies to share the table")
+	assert.Equal(uint64(69), s.Decrypt(c.Add(c.EncryptUint64(13), p.EncryptUint64(56))).Uint64())
+
+	// The mode is part of the encodings but not of the fingerprint
+	var p2 PublicPaillier
+	data, _ := p.MarshalBinary()
+	assert.Nil(p2.UnmarshalBinary(data))
+	assert.Equal(p.Fingerprint(), p2.Fingerprint())
+	assert.Equal(160, p2.shortBits)
+	der, _ := MarshalPaillierPublicKeyDER(p)
+	p3, err := ParsePaillierPublicKeyDER(der)
+	assert.Nil(err)
+	assert.Equal(p.Fingerprint(), p3.Fingerprint())
+	assert.Equal(uint64(69), s.Decrypt(p3.EncryptUint64(69)).Uint64())
+
+	// Too short exponents are refused by every import
+	for _, bits := range []int{1, 159, p.n.BitLen() + 1} {
+		weak := p
+		weak.shortBits = bits
+		data, _ := weak.MarshalBinary()
+		assert.True(errors.Is(p2.UnmarshalBinary(data), ErrInvalidKey), "Expected %d bit exponents to be refused", bits)
+		der, _ := MarshalPaillierPublicKeyDER(weak)
+		_, err := ParsePaillierPublicKeyDER(der)
+		assert.True(errors.Is(err, ErrInvalidKey), "Expected %d bit exponents to be refused", bits)
+		pem, _ := MarshalPaillierPublicKeyPEM(weak)
+		_, err = ParsePaillierPublicKeyPEM(pem)
+		assert.True(errors.Is(err, ErrInvalidKey), "Expected %d bit exponents to be refused", bits)
+	}
+
+	// A plain key of the same n stays interoperable
+	plain, err := newPublicPaillier(p.n, p.g)
+	assert.Nil(err)
+	assert.Equal(p.Fingerprint(), plain.Fingerprint())
+	assert.Equal(s.Fingerprint(), p.Fingerprint())
+	assert.Equal(uint64(69), s.Decrypt(plain.EncryptUint64(69)).Uint64())
+	sum, err := p.AddE(p.EncryptUint64(13), plain.EncryptUint64(56))
+	assert.Nil(err)
+	m, err := NewKeyRing(s).Decrypt(sum)
+	assert.Nil(err)
+	assert.Equal(uint64(69), m.Uint64())
+}
+
+func BenchmarkEncryptPaillier(b *testing.B) {
+	p1, _ := GenNewKeysPaillier(1024)
+	p2, _ := GenNewKeysPaillier(1024, WithShortExponents())
+	b.Run("Plain", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p1.EncryptUint64(69)
+		}
+	})
+	b.Run("ShortExponent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p2.EncryptUint64(69)
+		}
+	})
+}
+
+func TestBenalohEncryptionTables(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysBenaloh(1009, 512)
+	pt := p.WithEncryptionTables()
+	assert.Nil(p.yTable, "Expected the original key to stay without tables")
+	for _, m := range []uint64{0, 1, 1008, 1009, 69 + 1009*5, rnd.Uint64()} {
+		assert.Equal(m%1009, s.Decrypt(pt.EncryptUint64(m)).Uint64())
+	}
+	for _, m := range []int64{-1, -69, -1009, -2019} {
+		assert.Equal(uint64((m%1009+1009)%1009), s.Decrypt(pt.EncryptInt64(m)).Uint64())
+	}
+	c := pt.Copy().(PublicBenaloh)
+	assert.True(c.yTable == pt.yTable && c.yInvTable == pt.yInvTable, "Expected the copies to share the tables")
+	assert.Equal(uint64(69), s.Decrypt(c.Add(c.EncryptUint64(13), p.EncryptUint64(56))).Uint64())
+	assert.Equal(p.Fingerprint(), c.Fingerprint())
+}
+
+func BenchmarkEncryptBenaloh(b *testing.B) {
+	p, _ := GenNewKeysBenaloh(1<<20, 1024)
+	pt := p.WithEncryptionTables()
+	b.Run("Plain", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p.EncryptUint64(uint64(i))
+		}
+	})
+	b.Run("Tables", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pt.EncryptUint64(uint64(i))
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package phe
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// PrimePower is the factor Prime ** Exp of the plaintext modulus r of a
+// Benaloh key
+//
+// The decryption table of every prime has sqrt(Prime) entries so the
+// primes themselves are uint64, r can be much larger through the exponents
+// and the number of factors
+type PrimePower struct {
+	Prime uint64
+	Exp   int
+}
+
+// plaintextModulus checks that the factors are distinct primes with
+// positive exponents and returns their product r, which must have at
+// most maxBits bits
+func plaintextModulus(factors []PrimePower, maxBits int) (*big.Int, error) {
+	if len(factors) == 0 {
+		return nil, errors.New("r needs at least one factor")
+	}
+	r := nIntSetUint64(1)
+	seen := make(map[uint64]bool, len(factors))
+	for _, f := range factors {
+		if f.Prime < 2 || f.Exp < 1 || !isProbablePrime(f.Prime) {
+			return nil, errors.New("every factor of r must be a prime with a positive exponent")
+		}
+		if seen[f.Prime] {
+			return nil, errors.New("the primes of r must be distinct")
+		}
+		seen[f.Prime] = true
+		for i := 0; i < f.Exp && r.BitLen() <= maxBits; i++ {
+			r.Mul(r, nIntSetUint64(f.Prime))
+		}
+	}
+	if r.BitLen() > maxBits {
+		return nil, fmt.Errorf("r must have at most %d bits", maxBits)
+	}
+	return r, nil
+}
+
+// benalohFactor finds the plaintext modulo the factor l ** e of r, where
+// l is prime, with the Pohlig-Hellman algorithm
+//
+// With x = y ** ((p - 1) / r) of order r, the plaintext m of a ciphertext
+// gives a = x ** m mod p and a ** (r / l ** e) = xf ** m where xf has the
+// order l ** e. The digits of m mod l ** e in base l are then found one
+// at a time as logarithms to the base x ** (r / l), of order l, so the
+// table only has sqrt(l) entries
+//
+// A benalohFactor and its table are never modified once precompute
+// returns, so the copies of the key share them and decrypt from any number
+// of go routines at once
+type benalohFactor struct {
+	prime    uint64
+	exp      int
+	pe       *big.Int // l ** e
+	cofactor *big.Int // r / l ** e
+	// crt is 1 mod l ** e and 0 mod r / l ** e
+	crt *big.Int
+	// digitInv[k] = xf ** (-l ** k) mod p
+	digitInv []*big.Int
+	// base = x ** (r / l) of order l
+	base  *big.Int
+	table discreteLogTable
+}
+
+// newBenalohFactors computes everything but the values that depend on
+// the key, which are filled by precompute. r is the product of the factors
+func newBenalohFactors(factors []PrimePower, r *big.Int) []benalohFactor {
+	ans := make([]benalohFactor, len(factors))
+	for i, f := range factors {
+		pe := nInt().Exp(nIntSetUint64(f.Prime), nIntSetInt64(int64(f.Exp)), nil)
+		cofactor := divNew(r, pe)
+		ans[i] = benalohFactor{
+			prime:    f.Prime,
+			exp:      f.Exp,
+			pe:       pe,
+			cofactor: cofactor,
+			crt:      bigMod(mulNew(cofactor, invMod(cofactor, pe)), r),
+		}
+	}
+	return ans
+}
+
+// precompute fills the powers of f for x of order r modulo p, the table
+// to the base f.base is built separately
+func (f *benalohFactor) precompute(x, p *big.Int) {
+	l := nIntSetUint64(f.prime)
+	xf := powMod(x, f.cofactor, p)
+	f.digitInv = make([]*big.Int, f.exp)
+	f.digitInv[0] = invMod(xf, p)
+	for k := 1; k < f.exp; k++ {
+		f.digitInv[k] = powMod(f.digitInv[k-1], l, p)
+	}
+	// xf ** (l ** (e - 1)) = x ** (r / l) has the order l
+	f.base = invMod(f.digitInv[f.exp-1], p)
+}
+
+// log returns m mod l ** e for a = x ** m mod p, ok is false if a is
+// not a power of x
+func (f *benalohFactor) log(a *big.Int, ctxs *modContextPool) (m *big.Int, ok bool) {
+	p := ctxs.mm.mBig
+	l := nIntSetUint64(f.prime)
+	// cur = xf ** (m - digits found so far)
+	cur := powMod(a, f.cofactor, p)
+	m = nInt()
+	lk := nIntSetUint64(1)
+	for k := 0; k < f.exp; k++ {
+		// cur ** (l ** (e - 1 - k)) = g ** digit
+		h := powMod(cur, nInt().Exp(l, nIntSetInt64(int64(f.exp-1-k)), nil), p)
+		digit, found := f.table.log(h)
+		if !found {
+			return nil, false
+		}
+		d := nIntSetUint64(digit)
+		m.Add(m, mulNew(d, lk))
+		cur = bigMod(mulNew(cur, ctxs.exp(f.digitInv[k], d, l.BitLen())), p)
+		lk.Mul(lk, l)
+	}
+	// every digit was found so cur must be 1 now
+	return m, cur.Cmp(oneInt) == 0
+}
+
+// primePowers returns the factorization of r
+func (s SecretBenaloh) primePowers() []PrimePower {
+	ans := make([]PrimePower, len(s.factors))
+	for i, f := range s.factors {
+		ans[i] = PrimePower{Prime: f.prime, Exp: f.exp}
+	}
+	return ans
+}
+
+// generates checks that y ** ((p - 1) / l) != 1 mod p for every prime l
+// dividing r, so that x = y ** ((p - 1) / r) has the order r
+func (s SecretBenaloh) generates(y *big.Int) bool {
+	x := powModSecret(y, s.pOverR, s.p, s.p.BitLen())
+	for _, f := range s.factors {
+		if powMod(x, divNew(s.r, nIntSetUint64(f.prime)), s.p).Cmp(oneInt) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// precompute fills the tables used to find the discrete logarithm
+// of a = c ** ((p - 1) / r) mod p to the base x = y ** ((p - 1) / r)
+func (s *SecretBenaloh) precompute() {
+	s.precomputeDigits()
+	for i := range s.factors {
+		f := &s.factors[i]
+		f.table = newBSGSTable(f.base, f.prime, s.p)
+	}
+}
+
+// precomputeDigits does everything precompute does but building the tables
+func (s *SecretBenaloh) precomputeDigits() {
+	s.pCtxs = newModContextPool(s.p)
+	x := s.pCtxs.exp(s.y, s.pOverR, s.p.BitLen())
+	for i := range s.factors {
+		s.factors[i].precompute(x, s.p)
+	}
+}
+
+// discreteLog returns m in [0, r) such that a = x ** m mod p, recombining
+// the residues modulo the factors of r with the CRT
+func (s SecretBenaloh) discreteLog(a *big.Int) (*big.Int, bool) {
+	m := nInt()
+	for i := range s.factors {
+		mf, ok := s.factors[i].log(a, s.pCtxs)
+		if !ok {
+			return nil, false
+		}
+		m.Add(m, mulNew(mf, s.factors[i].crt))
+	}
+	return bigMod(m, s.r), true
+}
@@ -0,0 +1,138 @@
+package phe
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+func getCompositeSubtest(factors []PrimePower) func(*testing.T) {
+	return func(t *testing.T) {
+		assert := assert.New(t)
+		p, s := GenNewKeysBenalohComposite(factors, 512)
+		r, _ := plaintextModulus(factors, 512)
+		assert.Equal(r, p.PlaintextModulus())
+		for i := 0; i < 16; i++ {
+			m := nInt().Rand(rnd, r)
+			assert.Equal(m, s.Decrypt(p.EncryptInt(m)))
+		}
+		a := nInt().Sub(r, nIntSetUint64(13))
+		assert.Equal(nIntSetUint64(56), s.Decrypt(p.Add(p.EncryptInt(a), p.EncryptUint64(69))), "Expected the sum to wrap around r")
+		v, err := s.DecryptInt64(p.EncryptInt64(-69))
+		assert.Nil(err)
+		assert.Equal(int64(-69), v)
+		assert.True(s.IsZero(p.MulInt(p.EncryptUint64(1), r)))
+		assert.False(s.IsZero(p.EncryptUint64(1)))
+		if r.Bit(0) == 0 {
+			// otherwise the Jacobi symbol of the ciphertexts gives away m mod 2
+			assert.Equal(1, big.Jacobi(p.y, p.n))
+			assert.Equal(1, big.Jacobi(p.EncryptUint64(1).num, p.n))
+		}
+
+		// the tables only depend on the primes of r
+		for i, f := range factors {
+			assert.Equal(f.Prime, s.factors[i].table.(*bsgsTable).order)
+			assert.Equal(len(s.factors[i].digitInv), f.Exp)
+		}
+
+		var decoded SecretBenaloh
+		t.Run("Encoding", getKeyEncodingSubtest(s, &decoded))
+		assert.Equal(uint64(69), decoded.Decrypt(p.EncryptUint64(69)).Uint64())
+		c := s.Copy().(SecretBenaloh)
+		assert.Equal(uint64(69), c.Decrypt(p.EncryptUint64(69)).Uint64())
+	}
+}
+
+func TestCompositeBenaloh(t *testing.T) {
+	t.Run("PowerOfTwo", getCompositeSubtest([]PrimePower{{Prime: 2, Exp: 32}}))
+	t.Run("PowerOfThree", getCompositeSubtest([]PrimePower{{Prime: 3, Exp: 20}}))
+	t.Run("Smooth", getCompositeSubtest([]PrimePower{{Prime: 2, Exp: 4}, {Prime: 3, Exp: 3}, {Prime: 1009, Exp: 1}, {Prime: 65537, Exp: 2}}))
+	t.Run("Prime", getCompositeSubtest([]PrimePower{{Prime: 1000003, Exp: 1}}))
+	t.Run("Large", getCompositeSubtest([]PrimePower{{Prime: 2, Exp: 200}}))
+	t.Run("LargeSmooth", getCompositeSubtest([]PrimePower{{Prime: 2, Exp: 64}, {Prime: 3, Exp: 40}, {Prime: 1009, Exp: 3}}))
+
+	for _, factors := range [][]PrimePower{
+		nil,
+		{{Prime: 1, Exp: 3}},
+		{{Prime: 1, Exp: 1}, {Prime: 3, Exp: 2}},
+		{{Prime: 4, Exp: 1}},
+		{{Prime: 3, Exp: 0}},
+		{{Prime: 3, Exp: 2}, {Prime: 3, Exp: 1}},
+		{{Prime: 2, Exp: 255}},
+		{{Prime: 1<<32 - 5, Exp: 4}, {Prime: 3, Exp: 100}},
+	} {
+		_, _, err := GenerateKeysBenalohComposite(factors, 512)
+		assert.True(t, errors.Is(err, ErrWeakParameters), "Expected %v to be rejected", factors)
+	}
+
+	// the same factors must be refused when a key is decoded
+	_, s := GenNewKeysBenalohComposite([]PrimePower{{Prime: 3, Exp: 2}}, 512)
+	for _, factors := range [][]PrimePower{
+		{{Prime: 1, Exp: 3}},
+		{{Prime: 1, Exp: 1}, {Prime: 3, Exp: 2}},
+	} {
+		e := newKeyEncoder(keyEncodingVersion, secretBenalohKey)
+		for _, x := range []*big.Int{s.n, s.y, s.r, s.phi, nIntSetUint64(uint64(len(factors)))} {
+			e.int(x)
+		}
+		for _, f := range factors {
+			e.int(nIntSetUint64(f.Prime))
+			e.int(nIntSetUint64(uint64(f.Exp)))
+		}
+		var decoded SecretBenaloh
+		err := decoded.UnmarshalBinary(e.bytes())
+		assert.True(t, errors.Is(err, ErrWeakParameters), "Expected %v to be rejected", factors)
+	}
+}
+
+func TestSharedTables(t *testing.T) {
+	assert := assert.New(t)
+	p, s := GenNewKeysBenalohComposite([]PrimePower{{Prime: 2, Exp: 8}, {Prime: 65537, Exp: 1}}, 512)
+	c := s.Copy().(SecretBenaloh)
+	assert.True(&c.factors[0] == &s.factors[0], "Expected the copies to share the tables")
+	g, _ := s.WithGuardBand(nIntSetUint64(16))
+	assert.True(&g.factors[0] == &s.factors[0], "Expected the copies to share the tables")
+
+	// s decrypts from all the go routines at once without being copied
+	msgs := make([]uint64, 64)
+	v := make([]*Ciphertext, len(msgs))
+	for i := range msgs {
+		msgs[i] = rnd.Uint64() % (1 << 8 * 65537)
+		v[i] = p.EncryptUint64(msgs[i])
+	}
+	got := make([][]uint64, 8)
+	var wg sync.WaitGroup
+	for w := range got {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for _, c := range v {
+				got[w] = append(got[w], s.Decrypt(c).Uint64())
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, g := range got {
+		assert.Equal(msgs, g)
+	}
+}
+
+func BenchmarkDecryptBenaloh(b *testing.B) {
+	p1, s1 := GenNewKeysBenaloh(1<<32, 1024)
+	p2, s2 := GenNewKeysBenalohComposite([]PrimePower{{Prime: 2, Exp: 32}}, 1024)
+	c1 := p1.EncryptUint64(1<<31 + 69)
+	c2 := p2.EncryptUint64(1<<31 + 69)
+	b.ResetTimer()
+	b.Run("Prime", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s1.Decrypt(c1)
+		}
+	})
+	b.Run("PowerOfTwo", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s2.Decrypt(c2)
+		}
+	})
+}
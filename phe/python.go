@@ -0,0 +1,254 @@
+package phe
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// The functions below convert the keys and the encrypted numbers from and
+// to the JSON formats of the python-paillier library and of its pheutil
+// tool. Its keys always use g = n + 1 and store the integers as unpadded
+// base64url big endian bytes
+//
+//	public:  {"kty": "DAJ", "alg": "PAI-GN1", "key_ops": ["encrypt"], "n": ...}
+//	private: {"kty": "DAJ", "key_ops": ["decrypt"], "p": ..., "q": ..., "pub": {...}}
+//
+// An EncryptedNumber is stored as {"v": "<decimal ciphertext>", "e": exponent}
+// and its plaintext is mantissa * 16 ** exponent where the mantissa is the
+// decrypted value taken as negative when it is greater than n - n / 3
+
+const (
+	pythonKeyType   = "DAJ"
+	pythonAlgorithm = "PAI-GN1"
+	pythonBase      = 16
+)
+
+// python-paillier encodes the floats with exponents in [-282, 256], the
+// one of 5e-324 and the one of the largest precision, and multiplying an
+// EncryptedNumber by an encoded number adds their exponents. Exponents
+// beyond a few such products only come from malformed input and 16 ** e
+// could take any amount of memory
+const pythonMaxExponent = 1 << 12
+
+type pythonPublicKey struct {
+	Kty    string   `json:"kty"`
+	Alg    string   `json:"alg"`
+	KeyOps []string `json:"key_ops"`
+	N      string   `json:"n"`
+	Kid    string   `json:"kid,omitempty"`
+}
+
+type pythonPrivateKey struct {
+	Kty    string          `json:"kty"`
+	KeyOps []string        `json:"key_ops"`
+	P      string          `json:"p"`
+	Q      string          `json:"q"`
+	Pub    pythonPublicKey `json:"pub"`
+	Kid    string          `json:"kid,omitempty"`
+}
+
+type pythonEncryptedNumber struct {
+	V string `json:"v"`
+	E int    `json:"e"`
+}
+
+// PythonEncryptedNumber is an EncryptedNumber of python-paillier, a
+// ciphertext together with the base 16 exponent of its plaintext
+//
+// Integers have the exponent 0 so any ciphertext produced by
+// PublicPaillier.EncryptInt can be sent with a zero Exponent
+type PythonEncryptedNumber struct {
+	Ciphertext *Ciphertext
+	Exponent   int
+}
+
+// MarshalPythonPaillierPublicKey encodes the public key as a
+// python-paillier JWK public key
+//
+// It returns ErrInvalidKey if g is not n + 1 since python-paillier
+// doesn't support any other generator
+func MarshalPythonPaillierPublicKey(p PublicPaillier) ([]byte, error) {
+	k, err := newPythonPublicKey(p.n, p.g)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(k)
+}
+
+// ParsePythonPaillierPublicKey decodes a python-paillier JWK public key
+func ParsePythonPaillierPublicKey(data []byte) (PublicPaillier, error) {
+	var k pythonPublicKey
+	if err := json.Unmarshal(data, &k); err != nil {
+		return PublicPaillier{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	n, err := k.modulus()
+	if err != nil {
+		return PublicPaillier{}, err
+	}
+	return newPublicPaillier(n, addNew(n, oneInt))
+}
+
+// MarshalPythonPaillierPrivateKey encodes the secret key as a
+// python-paillier JWK private key holding the factors p and q of n
+func MarshalPythonPaillierPrivateKey(s SecretPaillier) ([]byte, error) {
+	pub, err := newPythonPublicKey(s.n, s.g)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(pythonPrivateKey{
+		Kty:    pythonKeyType,
+		KeyOps: []string{"decrypt"},
+		P:      pythonIntToBase64(s.p),
+		Q:      pythonIntToBase64(s.q),
+		Pub:    pub,
+	})
+}
+
+// ParsePythonPaillierPrivateKey decodes a python-paillier JWK private key
+// and returns it together with the public key it embeds
+func ParsePythonPaillierPrivateKey(data []byte) (PublicPaillier, SecretPaillier, error) {
+	var k pythonPrivateKey
+	if err := json.Unmarshal(data, &k); err != nil {
+		return PublicPaillier{}, SecretPaillier{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if k.Kty != pythonKeyType {
+		return PublicPaillier{}, SecretPaillier{}, fmt.Errorf("%w: unexpected key type %q", ErrInvalidKey, k.Kty)
+	}
+	n, err := k.Pub.modulus()
+	if err != nil {
+		return PublicPaillier{}, SecretPaillier{}, err
+	}
+	p1, err1 := pythonBase64ToInt(k.P)
+	p2, err2 := pythonBase64ToInt(k.Q)
+	if err1 != nil || err2 != nil {
+		return PublicPaillier{}, SecretPaillier{}, fmt.Errorf("%w: malformed p or q", ErrInvalidKey)
+	}
+	if mulNew(p1, p2).Cmp(n) != 0 {
+		return PublicPaillier{}, SecretPaillier{}, fmt.Errorf("%w: p * q is not n", ErrInvalidKey)
+	}
+	g := addNew(n, oneInt)
+	s, err := newSecretPaillier(p1, p2, g)
+	if err != nil {
+		return PublicPaillier{}, SecretPaillier{}, err
+	}
+	pk, err := newPublicPaillier(copyInt(n), copyInt(g))
+	if err != nil {
+		return PublicPaillier{}, SecretPaillier{}, err
+	}
+	return pk, s, nil
+}
+
+// MarshalPythonEncryptedNumber encodes e in the format of pheutil
+func MarshalPythonEncryptedNumber(e PythonEncryptedNumber) ([]byte, error) {
+	return json.Marshal(pythonEncryptedNumber{V: e.Ciphertext.num.String(), E: e.Exponent})
+}
+
+// UnmarshalPythonEncryptedNumber decodes an EncryptedNumber produced by
+// python-paillier under the public key p
+//
+// It returns ErrInvalidCiphertext if the ciphertext doesn't pass
+// p.Validate. The JSON doesn't identify the key so the ciphertext is
+// bound to p
+func UnmarshalPythonEncryptedNumber(p PublicPaillier, data []byte) (PythonEncryptedNumber, error) {
+	var v pythonEncryptedNumber
+	if err := json.Unmarshal(data, &v); err != nil {
+		return PythonEncryptedNumber{}, fmt.Errorf("%w: %v", ErrInvalidCiphertext, err)
+	}
+	if err := checkPythonExponent(v.E); err != nil {
+		return PythonEncryptedNumber{}, err
+	}
+	num, ok := nInt().SetString(v.V, 10)
+	if !ok {
+		return PythonEncryptedNumber{}, fmt.Errorf("%w: malformed ciphertext", ErrInvalidCiphertext)
+	}
+	c := &Ciphertext{num: num, bind: p.bind}
+	if err := p.Validate(c); err != nil {
+		return PythonEncryptedNumber{}, err
+	}
+	return PythonEncryptedNumber{Ciphertext: c, Exponent: v.E}, nil
+}
+
+// DecryptPython decrypts an EncryptedNumber of python-paillier and
+// decodes its plaintext as mantissa * 16 ** exponent
+//
+// It returns ErrDecryptionFailed if the mantissa falls between n / 3
+// and n - n / 3, which python-paillier reports as an overflow, and
+// ErrInvalidCiphertext if the exponent is out of the range python-paillier
+// produces
+func (s SecretPaillier) DecryptPython(e PythonEncryptedNumber) (*big.Rat, error) {
+	if err := checkPythonExponent(e.Exponent); err != nil {
+		return nil, err
+	}
+	m, err := s.DecryptE(e.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	// maxInt = n / 3 - 1 is the largest positive mantissa
+	maxInt := subNew(divNew(s.n, nIntSetUint64(3)), oneInt)
+	m, ok := toSigned(m, s.n, maxInt)
+	if !ok {
+		return nil, fmt.Errorf("%w: the plaintext overflowed", ErrDecryptionFailed)
+	}
+	scale := nInt().Exp(nIntSetUint64(pythonBase), nIntSetInt64(int64(abs(e.Exponent))), nil)
+	if e.Exponent >= 0 {
+		return new(big.Rat).SetInt(mulNew(m, scale)), nil
+	}
+	return new(big.Rat).SetFrac(m, scale), nil
+}
+
+func checkPythonExponent(e int) error {
+	if e < -pythonMaxExponent || e > pythonMaxExponent {
+		return fmt.Errorf("%w: the exponent %d is out of [%d, %d]", ErrInvalidCiphertext, e, -pythonMaxExponent, pythonMaxExponent)
+	}
+	return nil
+}
+
+func newPythonPublicKey(n, g *big.Int) (pythonPublicKey, error) {
+	if g.Cmp(addNew(n, oneInt)) != 0 {
+		return pythonPublicKey{}, fmt.Errorf("%w: python-paillier requires g = n + 1", ErrInvalidKey)
+	}
+	return pythonPublicKey{
+		Kty:    pythonKeyType,
+		Alg:    pythonAlgorithm,
+		KeyOps: []string{"encrypt"},
+		N:      pythonIntToBase64(n),
+	}, nil
+}
+
+// modulus checks the type of the key and returns n
+func (k pythonPublicKey) modulus() (*big.Int, error) {
+	if k.Kty != pythonKeyType {
+		return nil, fmt.Errorf("%w: unexpected key type %q", ErrInvalidKey, k.Kty)
+	}
+	if k.Alg != pythonAlgorithm {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidKey, k.Alg)
+	}
+	n, err := pythonBase64ToInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed n", ErrInvalidKey)
+	}
+	return n, nil
+}
+
+func pythonIntToBase64(x *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(x.Bytes())
+}
+
+// pythonBase64ToInt accepts both padded and unpadded base64url
+func pythonBase64ToInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return nInt().SetBytes(b), nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
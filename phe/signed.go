@@ -0,0 +1,66 @@
+package phe
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// signedPlaintext maps the plaintext m in [0, mod) to the signed value
+// m or m - mod, whichever is in [-max, max] where
+//
+//	max = (mod - 1 - guard) / 2
+//
+// and returns ErrOverflow for the plaintexts around mod / 2 that are in
+// neither range. There are `guard` of them, or one more when needed to
+// keep the range symmetric. A nil guard is no band at all so every
+// plaintext is mapped, the ones above (mod - 1) / 2 to negative values down
+// to -mod / 2 for an even mod like two's complement
+//
+// A wider band detects more of the sums and products that wrapped around
+// mod at the cost of a smaller range of values
+func signedPlaintext(m, mod, guard *big.Int) (*big.Int, error) {
+	max := subNew(mod, oneInt)
+	if guard == nil {
+		max.Rsh(max, 1)
+		if m.Cmp(max) <= 0 {
+			return m, nil
+		}
+		return subNew(m, mod), nil
+	}
+	sub(max, guard)
+	max.Rsh(max, 1)
+	v, ok := toSigned(m, mod, max)
+	if !ok {
+		return nil, fmt.Errorf("%w: the plaintext is in the guard band", ErrOverflow)
+	}
+	return v, nil
+}
+
+// toSigned returns m for m <= max and m - mod for m >= mod - max, ok is
+// false for the plaintexts in between
+func toSigned(m, mod, max *big.Int) (v *big.Int, ok bool) {
+	if m.Cmp(max) <= 0 {
+		return m, true
+	}
+	if m.Cmp(subNew(mod, max)) < 0 {
+		return nil, false
+	}
+	return subNew(m, mod), true
+}
+
+func plaintextInt64(m *big.Int, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if !m.IsInt64() {
+		return 0, fmt.Errorf("%w: the plaintext doesn't fit in an int64", ErrOverflow)
+	}
+	return m.Int64(), nil
+}
+
+func checkGuardBand(width, mod *big.Int) error {
+	if width.Sign() < 0 || width.Cmp(mod) >= 0 {
+		return fmt.Errorf("%w: the guard band must be in [0, %v)", ErrInvalidKey, mod)
+	}
+	return nil
+}
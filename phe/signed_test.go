@@ -0,0 +1,91 @@
+package phe
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func getSignedSubtest(s SecretKey, p PublicKey) func(*testing.T) {
+	return func(t *testing.T) {
+		assert := assert.New(t)
+		for _, m := range []int64{0, 1, -1, 69, -69, 504, -504} {
+			v, err := s.DecryptInt64(p.EncryptInt64(m))
+			assert.Nil(err)
+			assert.Equal(m, v)
+		}
+		_, err := s.DecryptSigned(nil)
+		assert.True(errors.Is(err, ErrInvalidCiphertext))
+	}
+}
+
+func TestDecryptSigned(t *testing.T) {
+	p1, s1 := GenNewKeysPaillier(512)
+	p2, s2 := GenNewKeysBenaloh(1009, 512)
+	t.Run("Paillier", getSignedSubtest(s1, p1))
+	t.Run("Benaloh", getSignedSubtest(s2, p2))
+
+	assert := assert.New(t)
+	// without a guard band the plaintexts above 1009 / 2 are negative
+	v, err := s2.DecryptInt64(p2.EncryptUint64(505))
+	assert.Nil(err)
+	assert.Equal(int64(-504), v)
+
+	// a band of 10 plaintexts leaves [-499, 499]
+	g, err := s2.WithGuardBand(nIntSetUint64(10))
+	assert.Nil(err)
+	assert.Nil(s2.guard, "Expected the original key to keep no guard band")
+	for m := uint64(495); m < 515; m++ {
+		v, err := g.DecryptInt64(p2.EncryptUint64(m))
+		if m >= 500 && m <= 509 {
+			assert.True(errors.Is(err, ErrOverflow), "Expected %d to be in the guard band", m)
+			continue
+		}
+		assert.Nil(err)
+		if m < 500 {
+			assert.Equal(int64(m), v)
+		} else {
+			assert.Equal(int64(m)-1009, v)
+		}
+	}
+	c := g.Copy().(SecretBenaloh)
+	_, err = c.DecryptSigned(p2.EncryptUint64(504))
+	assert.True(errors.Is(err, ErrOverflow), "Expected the copies to keep the guard band")
+
+	// a plaintext that doesn't fit in an int64 is an overflow
+	large := nInt().Lsh(oneInt, 70)
+	m, err := s1.DecryptSigned(p1.EncryptInt(nInt().Neg(large)))
+	assert.Nil(err)
+	assert.Equal(nInt().Neg(large), m)
+	_, err = s1.DecryptInt64(p1.EncryptInt(large))
+	assert.True(errors.Is(err, ErrOverflow), "Expected 2 ** 70 not to fit in an int64")
+
+	// the band of the Paillier key catches a sum that wrapped around
+	gp, err := s1.WithGuardBand(nInt().Rsh(s1.n, 1))
+	assert.Nil(err)
+	half := nInt().Rsh(s1.n, 2)
+	_, err = gp.DecryptSigned(p1.Add(p1.EncryptInt(half), p1.EncryptInt(half)))
+	assert.True(errors.Is(err, ErrOverflow), "Expected n / 2 to be in the guard band")
+
+	// with an even modulus and no band r / 2 is -r / 2, a band of 0 leaves
+	// it out to keep the range symmetric
+	p3, s3 := GenNewKeysBenalohComposite([]PrimePower{{Prime: 2, Exp: 16}}, 512)
+	for m, want := range map[uint64]int64{1<<15 - 1: 1<<15 - 1, 1 << 15: -1 << 15, 1<<15 + 1: 1 - 1<<15} {
+		v, err := s3.DecryptInt64(p3.EncryptUint64(m))
+		assert.Nil(err)
+		assert.Equal(want, v)
+	}
+	v, err = s3.DecryptInt64(p3.EncryptInt64(-1 << 15))
+	assert.Nil(err)
+	assert.Equal(int64(-1<<15), v)
+	g3, err := s3.WithGuardBand(nIntSetUint64(0))
+	assert.Nil(err)
+	_, err = g3.DecryptInt64(p3.EncryptUint64(1 << 15))
+	assert.True(errors.Is(err, ErrOverflow), "Expected r / 2 to be left out by a band of 0")
+
+	for _, width := range []*big.Int{nIntSetInt64(-1), nIntSetUint64(1009)} {
+		_, err = s2.WithGuardBand(width)
+		assert.True(errors.Is(err, ErrInvalidKey), "Expected %v to be rejected", width)
+	}
+}
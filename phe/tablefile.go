@@ -0,0 +1,232 @@
+package phe
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// The decryption tables of a Benaloh secret key are written as
+//
+//	magic (8 bytes) | version (8 bytes) | key fingerprint (32 bytes) | count (8 bytes)
+//	count times: prime (8 bytes) | number of slots (8 bytes)
+//	count times: the slots of the bsgsTable of the prime
+//	checksum (32 bytes)
+//
+// with every integer in little endian, so the slots are used in place once
+// the file is mapped. The checksum is the HMAC-SHA256 of the whole file
+// before it keyed by the binary encoding of the secret key, so only the
+// owner of the key can write tables that it accepts
+
+const (
+	tableFileVersion    = 1
+	tableFileHeaderSize = 8 + 8 + sha256.Size + 8
+	tableFileEntrySize  = 16
+)
+
+var tableFileMagic = []byte("PHEBSGS\x00")
+
+// WriteTables writes the decryption tables of s to w, the file can then be
+// opened with OpenTableFile and given to UnmarshalSecretBenaloh or
+// WithTableFile instead of computing the tables again
+func (s SecretBenaloh) WriteTables(w io.Writer) error {
+	mac, err := s.tableMAC()
+	if err != nil {
+		return err
+	}
+	header := make([]byte, tableFileHeaderSize+tableFileEntrySize*len(s.factors))
+	copy(header, tableFileMagic)
+	binary.LittleEndian.PutUint64(header[8:], tableFileVersion)
+	fp := s.Fingerprint()
+	copy(header[16:], fp[:])
+	binary.LittleEndian.PutUint64(header[16+sha256.Size:], uint64(len(s.factors)))
+	tables := make([]*bsgsTable, len(s.factors))
+	for i, f := range s.factors {
+		t, ok := f.table.(*bsgsTable)
+		if !ok {
+			return fmt.Errorf("%w: %T can't be written", ErrInvalidTable, f.table)
+		}
+		tables[i] = t
+		entry := header[tableFileHeaderSize+i*tableFileEntrySize:]
+		binary.LittleEndian.PutUint64(entry, f.prime)
+		binary.LittleEndian.PutUint64(entry[8:], uint64(len(t.slots)/bsgsSlotSize))
+	}
+	mac.Write(header)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		mac.Write(t.slots)
+		if _, err := w.Write(t.slots); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(mac.Sum(nil))
+	return err
+}
+
+// tableMAC returns the HMAC computing the checksum of the table files of s
+func (s SecretBenaloh) tableMAC() (hash.Hash, error) {
+	key, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	return hmac.New(sha256.New, key), nil
+}
+
+// TableFile is a file of decryption tables written by
+// SecretBenaloh.WriteTables
+//
+// On Linux the file is mapped into memory with mmap so opening it costs
+// nothing until the tables are used, elsewhere it is read into memory
+//
+// The mapping is private but the pages that weren't read yet still come
+// from the file, so the file must not change while it is open. A change
+// can make the decryption fail with ErrDecryptionFailed, since every
+// logarithm found in the tables is checked, and a truncation is undefined:
+// reading past the new end of the file crashes the process with SIGBUS.
+// OpenTableFile holds a shared flock while it maps the file so the writers
+// taking the lock don't truncate it in between
+type TableFile struct {
+	data []byte
+}
+
+// OpenTableFile opens a file written by SecretBenaloh.WriteTables
+//
+// The tables are only checked against a key by WithTableFile and
+// UnmarshalSecretBenaloh
+func OpenTableFile(path string) (*TableFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := mapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < tableFileHeaderSize+sha256.Size {
+		unmapFile(data)
+		return nil, fmt.Errorf("%w: too short", ErrInvalidTable)
+	}
+	return &TableFile{data: data}, nil
+}
+
+// fileSize returns the size of f, which must fit in an int
+func fileSize(f *os.File) (int, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if int64(int(size)) != size {
+		return 0, fmt.Errorf("%w: too large", ErrInvalidTable)
+	}
+	return int(size), nil
+}
+
+// Close releases the file
+//
+// The keys decrypting with its tables must not be used afterwards
+func (t *TableFile) Close() error {
+	if t.data == nil {
+		return nil
+	}
+	err := unmapFile(t.data)
+	t.data = nil
+	return err
+}
+
+// WithTableFile returns a copy of s that decrypts with the tables of t
+// instead of its own
+//
+// It returns ErrInvalidTable if the file is malformed, it was modified or
+// it was written for another key. The whole file is read to check it. The returned key and its
+// copies must not be used once t is closed
+func (s SecretBenaloh) WithTableFile(t *TableFile) (SecretBenaloh, error) {
+	tables, err := t.tables(s)
+	if err != nil {
+		return SecretBenaloh{}, err
+	}
+	// the factors of s are shared with its other copies
+	s.factors = append([]benalohFactor(nil), s.factors...)
+	for i := range s.factors {
+		s.factors[i].table = tables[i]
+	}
+	return s, nil
+}
+
+// UnmarshalSecretBenaloh decodes a secret key encoded by MarshalBinary in
+// the same way as UnmarshalBinary but takes the decryption tables from t
+// instead of computing them, see WithTableFile
+func UnmarshalSecretBenaloh(data []byte, t *TableFile) (SecretBenaloh, error) {
+	key, err := decodeSecretBenaloh(data)
+	if err != nil {
+		return SecretBenaloh{}, err
+	}
+	return key.WithTableFile(t)
+}
+
+// tables checks the file against s and returns its tables in the order
+// of the factors of s
+func (t *TableFile) tables(s SecretBenaloh) ([]discreteLogTable, error) {
+	data := t.data
+	if data == nil {
+		return nil, fmt.Errorf("%w: the file is closed", ErrInvalidTable)
+	}
+	if !bytes.Equal(data[:8], tableFileMagic) {
+		return nil, fmt.Errorf("%w: not a table file", ErrInvalidTable)
+	}
+	if v := binary.LittleEndian.Uint64(data[8:]); v != tableFileVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidTable, v)
+	}
+	if fp := s.Fingerprint(); !bytes.Equal(data[16:16+sha256.Size], fp[:]) {
+		return nil, fmt.Errorf("%w: the tables belong to another key", ErrInvalidTable)
+	}
+	if count := binary.LittleEndian.Uint64(data[16+sha256.Size:]); count != uint64(len(s.factors)) {
+		return nil, fmt.Errorf("%w: %d tables for %d factors", ErrInvalidTable, count, len(s.factors))
+	}
+	header := tableFileHeaderSize + tableFileEntrySize*len(s.factors)
+	if header+sha256.Size > len(data) {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidTable)
+	}
+	end := uint64(len(data) - sha256.Size)
+	off := uint64(header)
+	sizes := make([]uint64, len(s.factors))
+	for i, f := range s.factors {
+		entry := data[tableFileHeaderSize+i*tableFileEntrySize:]
+		prime, slots := binary.LittleEndian.Uint64(entry), binary.LittleEndian.Uint64(entry[8:])
+		if prime != f.prime || slots != bsgsSlots(f.prime) {
+			return nil, fmt.Errorf("%w: the tables don't match the factors of r", ErrInvalidTable)
+		}
+		sizes[i] = slots * bsgsSlotSize
+		if sizes[i] > end-off {
+			return nil, fmt.Errorf("%w: too short", ErrInvalidTable)
+		}
+		off += sizes[i]
+	}
+	if off != end {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidTable)
+	}
+	mac, err := s.tableMAC()
+	if err != nil {
+		return nil, err
+	}
+	mac.Write(data[:end])
+	if !hmac.Equal(mac.Sum(nil), data[end:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidTable)
+	}
+	off = uint64(header)
+	tables := make([]discreteLogTable, len(s.factors))
+	for i, f := range s.factors {
+		tables[i] = bsgsTableFromSlots(f.base, f.prime, s.p, data[off:off+sizes[i]])
+		off += sizes[i]
+	}
+	return tables, nil
+}
@@ -0,0 +1,135 @@
+package phe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTableFile writes the tables of s to a file in dir and returns its path
+func writeTableFile(t testing.TB, s SecretBenaloh, dir string) string {
+	var buf bytes.Buffer
+	assert.Nil(t, s.WriteTables(&buf))
+	path := filepath.Join(dir, "tables")
+	assert.Nil(t, ioutil.WriteFile(path, buf.Bytes(), 0600))
+	return path
+}
+
+func TestTableFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "phe")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	p, s := GenNewKeysBenalohComposite([]PrimePower{{Prime: 2, Exp: 8}, {Prime: 1000003, Exp: 1}}, 512)
+	f, err := OpenTableFile(writeTableFile(t, s, dir))
+	assert.Nil(err)
+	defer f.Close()
+
+	data, _ := s.MarshalBinary()
+	decoded, err := UnmarshalSecretBenaloh(data, f)
+	assert.Nil(err)
+	table := decoded.factors[1].table.(*bsgsTable)
+	// the last table ends right before the checksum
+	assert.True(&table.slots[len(table.slots)-1] == &f.data[len(f.data)-sha256.Size-1], "Expected the table to be read from the file")
+	for i := 0; i < 16; i++ {
+		m := rnd.Uint64() % (1 << 8 * 1000003)
+		c := p.EncryptUint64(m)
+		assert.Equal(m, decoded.Decrypt(c).Uint64())
+		assert.Equal(m, decoded.Copy().Decrypt(c).Uint64())
+	}
+	// the tables of s itself are left alone
+	with, err := s.WithTableFile(f)
+	assert.Nil(err)
+	assert.True(with.factors[1].table != s.factors[1].table)
+	assert.Equal(uint64(69), with.Decrypt(p.EncryptUint64(69)).Uint64())
+
+	// another key with the same factors
+	_, other := GenNewKeysBenalohComposite([]PrimePower{{Prime: 2, Exp: 8}, {Prime: 1000003, Exp: 1}}, 512)
+	_, err = other.WithTableFile(f)
+	assert.True(errors.Is(err, ErrInvalidTable), "Expected the tables of another key to be refused")
+}
+
+func TestTableFileCorrupted(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "phe")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	_, s := GenNewKeysBenaloh(1009, 512)
+	var buf bytes.Buffer
+	assert.Nil(s.WriteTables(&buf))
+	good := buf.Bytes()
+	path := filepath.Join(dir, "tables")
+	slots := tableFileHeaderSize + tableFileEntrySize
+
+	for name, corrupt := range map[string]func([]byte) []byte{
+		"Magic":     func(b []byte) []byte { b[0] ^= 1; return b },
+		"Version":   func(b []byte) []byte { b[8] = 2; return b },
+		"Count":     func(b []byte) []byte { b[16+32] = 2; return b },
+		"Prime":     func(b []byte) []byte { b[tableFileHeaderSize]++; return b },
+		"Checksum":  func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+		"Truncated": func(b []byte) []byte { return b[:len(b)-17] },
+		"Trailing":  func(b []byte) []byte { return append(b, make([]byte, 16)...) },
+		"Slots": func(b []byte) []byte {
+			for i := slots; i < len(b)-sha256.Size; i += 97 {
+				b[i] ^= 1
+			}
+			return b
+		},
+		// no empty slot ends the probes
+		"Full": func(b []byte) []byte {
+			for i := slots + 8; i < len(b)-sha256.Size; i += bsgsSlotSize {
+				b[i] = 1
+			}
+			return b
+		},
+	} {
+		data := corrupt(append([]byte(nil), good...))
+		assert.Nil(ioutil.WriteFile(path, data, 0600))
+		f, err := OpenTableFile(path)
+		assert.Nil(err, name)
+		_, err = s.WithTableFile(f)
+		assert.True(errors.Is(err, ErrInvalidTable), "Expected ErrInvalidTable for %s, got %v", name, err)
+		assert.Nil(f.Close())
+	}
+
+	assert.Nil(ioutil.WriteFile(path, good[:40], 0600))
+	_, err = OpenTableFile(path)
+	assert.True(errors.Is(err, ErrInvalidTable), "Expected ErrInvalidTable for a short file")
+
+	// the tables of a closed file can't be used
+	assert.Nil(ioutil.WriteFile(path, good, 0600))
+	f, err := OpenTableFile(path)
+	assert.Nil(err)
+	assert.Nil(f.Close())
+	_, err = s.WithTableFile(f)
+	assert.True(errors.Is(err, ErrInvalidTable))
+}
+
+func BenchmarkLoadSecretBenaloh(b *testing.B) {
+	dir, _ := ioutil.TempDir("", "phe")
+	defer os.RemoveAll(dir)
+	_, s := GenNewKeysBenaloh(1<<32, 1024)
+	data, _ := s.MarshalBinary()
+	path := writeTableFile(b, s, dir)
+	b.ResetTimer()
+	b.Run("Compute", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var key SecretBenaloh
+			key.UnmarshalBinary(data)
+		}
+	})
+	b.Run("TableFile", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			f, _ := OpenTableFile(path)
+			UnmarshalSecretBenaloh(data, f)
+			f.Close()
+		}
+	})
+}
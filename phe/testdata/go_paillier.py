@@ -0,0 +1,49 @@
+"""Decrypts go_paillier.json with python-paillier
+
+go_paillier.json holds a key and EncryptedNumbers produced by python.go,
+it is written by
+
+    go test -run TestGoPaillierVectors -update-go-paillier
+
+and checked against python-paillier at the version pinned below with
+
+    pip install phe==1.5.0
+    python3 go_paillier.py
+"""
+
+import json
+import sys
+from fractions import Fraction
+
+import phe
+from phe.util import base64_to_int
+
+PHE_VERSION = "1.5.0"
+
+if phe.__version__ != PHE_VERSION:
+    raise SystemExit("python-paillier %s is needed, found %s"
+                     % (PHE_VERSION, phe.__version__))
+
+with open("go_paillier.json") as f:
+    vectors = json.load(f)
+
+public = phe.PaillierPublicKey(n=base64_to_int(vectors["public_key"]["n"]))
+priv = vectors["private_key"]
+if base64_to_int(priv["pub"]["n"]) != public.n:
+    raise SystemExit("the private key embeds another public key")
+private = phe.PaillierPrivateKey(public, base64_to_int(priv["p"]),
+                                 base64_to_int(priv["q"]))
+
+failed = 0
+for number in vectors["numbers"]:
+    encrypted = phe.EncryptedNumber(public, int(number["encrypted"]["v"]),
+                                    int(number["encrypted"]["e"]))
+    got = Fraction(private.decrypt(encrypted))
+    want = Fraction(number["plaintext"])
+    if got != want:
+        print("%s decrypted to %s" % (want, got))
+        failed += 1
+
+if failed:
+    sys.exit(1)
+print("all %d numbers decrypted" % len(vectors["numbers"]))
@@ -0,0 +1,56 @@
+"""Generates python_paillier.json, the test vectors of python.go
+
+The vectors are produced by python-paillier
+(https://github.com/data61/python-paillier) at the version pinned below
+
+    pip install phe==1.5.0
+    python3 python_paillier.py
+
+The keys are written as the JWK keys of its pheutil tool, without the kid
+holding the generation date, and the EncryptedNumbers as
+{"v": ciphertext, "e": exponent} like pheutil and the library README do
+"""
+
+import json
+from fractions import Fraction
+
+import phe
+from phe.util import int_to_base64
+
+PHE_VERSION = "1.5.0"
+
+if phe.__version__ != PHE_VERSION:
+    raise SystemExit("python-paillier %s is needed, found %s"
+                     % (PHE_VERSION, phe.__version__))
+
+public, private = phe.generate_paillier_keypair(n_length=512)
+
+public_key = {
+    "kty": "DAJ",
+    "alg": "PAI-GN1",
+    "key_ops": ["encrypt"],
+    "n": int_to_base64(public.n),
+}
+private_key = {
+    "kty": "DAJ",
+    "key_ops": ["decrypt"],
+    "p": int_to_base64(private.p),
+    "q": int_to_base64(private.q),
+    "pub": public_key,
+}
+
+numbers = []
+for scalar in [0, 69, -69, 2 ** 100, -(2 ** 100), 3.5, -0.15625, 1e-3]:
+    encrypted = public.encrypt(scalar)
+    numbers.append({
+        "plaintext": str(Fraction(scalar)),
+        "encrypted": {"v": str(encrypted.ciphertext()), "e": encrypted.exponent},
+    })
+
+with open("python_paillier.json", "w") as f:
+    json.dump({
+        "public_key": public_key,
+        "private_key": private_key,
+        "numbers": numbers,
+    }, f, indent=2)
+    f.write("\n")
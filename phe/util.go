@@ -1,6 +1,8 @@
 package phe
 
 import (
+	cRand "crypto/rand"
+	"io"
 	"math/big"
 )
 
@@ -15,6 +17,13 @@ func copyInt(x *big.Int) *big.Int {
 	return nInt().Set(x)
 }
 
+func copyIntOrNil(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return copyInt(x)
+}
+
 func copyIntSlice(s []*big.Int) (ans []*big.Int) {
 	N := len(s)
 	ans = make([]*big.Int, N, N)
@@ -24,15 +33,49 @@ func copyIntSlice(s []*big.Int) (ans []*big.Int) {
 	return
 }
 
-func copyRootPowerSlice(s []rootPower) (ans []rootPower) {
-	N := len(s)
-	ans = make([]rootPower, N, N)
-	for idx, rPow := range s {
-		ans[idx] = rootPower{
-			power: rPow.power,
-			num:   copyInt(rPow.num),
+// randomInt returns a uniform random integer in [0, max) read from random
+func randomInt(random io.Reader, max *big.Int) (*big.Int, error) {
+	ans, err := cRand.Int(random, max)
+	if err != nil {
+		return nil, entropyError{err}
+	}
+	return ans, nil
+}
+
+// randomUnit returns a uniform random integer in [1, n) coprime with n
+func randomUnit(random io.Reader, n *big.Int) (*big.Int, error) {
+	for {
+		ans, err := randomInt(random, n)
+		if err != nil {
+			return nil, err
+		}
+		if ans.Sign() > 0 && nInt().GCD(nil, nil, ans, n).Cmp(oneInt) == 0 {
+			return ans, nil
 		}
 	}
+}
+
+// paillierFactors recovers the primes p and q of n = p * q from
+// phi = (p - 1) * (q - 1) as the roots of x ** 2 - (n - phi + 1) * x + n
+//
+// It returns nil if phi doesn't correspond to such a factorization
+func paillierFactors(n, phi *big.Int) (p, q *big.Int) {
+	// p + q = n - phi + 1
+	sum := addNew(subNew(n, phi), oneInt)
+	// (p - q) ** 2 = (p + q) ** 2 - 4 * n
+	d2 := subNew(mulNew(sum, sum), mulNew(n, nIntSetUint64(4)))
+	if d2.Sign() < 0 {
+		return nil, nil
+	}
+	d := nInt().Sqrt(d2)
+	if mulNew(d, d).Cmp(d2) != 0 {
+		return nil, nil
+	}
+	p = divNew(addNew(sum, d), nIntSetUint64(2))
+	q = divNew(subNew(sum, d), nIntSetUint64(2))
+	if q.Cmp(oneInt) <= 0 || mulNew(p, q).Cmp(n) != 0 {
+		return nil, nil
+	}
 	return
 }
 
@@ -48,16 +91,16 @@ func nIntSetUint64(x uint64) *big.Int {
 	return nInt().SetUint64(x)
 }
 
-func mul(a, b *big.Int) {
-	a.Mul(a, b)
+func mul(a, b *big.Int) *big.Int {
+	return a.Mul(a, b)
 }
 
 func mulNew(a, b *big.Int) *big.Int {
 	return nInt().Mul(a, b)
 }
 
-func add(a, b *big.Int) {
-	a.Add(a, b)
+func add(a, b *big.Int) *big.Int {
+	return a.Add(a, b)
 }
 
 func addNew(a, b *big.Int) *big.Int {
@@ -84,6 +127,8 @@ func invMod(a, b *big.Int) *big.Int {
 	return nInt().ModInverse(a, b)
 }
 
+// powMod branches on every bit of b so it must only be used with
+// public exponents, secret ones go through powModSecret
 func powMod(a, b, mod *big.Int) (ans *big.Int) {
 	ans = nIntSetUint64(1)
 	c := nIntSetUint64(1)
@@ -105,20 +150,3 @@ func powMod(a, b, mod *big.Int) (ans *big.Int) {
 	}
 	return
 }
-
-func powModUint64(a *big.Int, b uint64, mod *big.Int) *big.Int {
-	ans := nIntSetUint64(1)
-	c := nIntSetUint64(1)
-	mul(c, a)
-	// The number of iterations should be fixed to combat timing attacks
-	for p := 0; p < 64; p++ {
-		if (b & 1) == 1 {
-			mul(ans, c)
-			bigMod(ans, mod)
-		}
-		mul(c, c)
-		bigMod(c, mod)
-		b >>= 1
-	}
-	return ans
-}
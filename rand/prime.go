@@ -15,8 +15,6 @@ import (
 	"math/big"
 )
 
-const uint64Max = (1 << 64) - 1
-
 var smallPrimes = []uint8{
 	2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53,
 }
@@ -27,11 +25,22 @@ var oneInt = new(big.Int).SetUint64(1)
 
 // Prime generates a random prime p with `bits` being the maximum number of
 // bits such that r | p - 1
-func Prime(rand io.Reader, bits int, r uint64) (p *big.Int, err error) {
+//
+// With r = 1 it generates an ordinary random prime. Unlike crypto/rand.Prime
+// every random byte is always read from `rand`, so the caller is in control
+// of the entropy source
+//
+// r must be positive and shorter than `bits`, otherwise there is no room
+// for p above r
+func Prime(rand io.Reader, bits int, r *big.Int) (p *big.Int, err error) {
 	if bits < 2 {
 		err = errors.New("crypto/rand: prime size must be at least 2-bit")
 		return
 	}
+	if r.Sign() <= 0 || r.BitLen() >= bits {
+		err = errors.New("crypto/rand: r must be positive and shorter than the prime")
+		return
+	}
 
 	b := uint(bits % 8)
 	if b == 0 {
@@ -43,7 +52,8 @@ func Prime(rand io.Reader, bits int, r uint64) (p *big.Int, err error) {
 
 	bigMod := new(big.Int)
 
-	rBig := new(big.Int).SetUint64(r)
+	// only the residue of r modulo the small primes matters for the sieve
+	rMod := new(big.Int).Mod(r, smallPrimesProduct).Uint64()
 
 	for {
 		_, err = io.ReadFull(rand, bytes)
@@ -73,36 +83,38 @@ func Prime(rand io.Reader, bits int, r uint64) (p *big.Int, err error) {
 
 		// If p > r then make p be equivalent to 1 mod r
 		// By taking p = p - ((p - 1) mod r)
-		if p.Cmp(rBig) > 0 {
+		if p.Cmp(r) > 0 {
 			// p - 1
 			bigMod.Sub(p, oneInt)
 			// (p - 1) mod r
-			bigMod.Mod(bigMod, rBig)
+			bigMod.Mod(bigMod, r)
 			// p - ((p - 1) mod r)
 			p.Sub(p, bigMod)
 		} else {
 			continue
 		}
 
-		// Calculate the value mod the product of smallPrimes. If it's
-		// a multiple of any of these primes we add two until it isn't.
-		// The probability of overflowing is minimal and can be ignored
-		// because we still perform Miller-Rabin tests on the result.
+		// Calculate the value mod the product of smallPrimes. If p + delta * r
+		// is a multiple of any of these primes we add two to delta until it
+		// isn't. The residues are taken modulo every small prime so they
+		// never overflow, whatever the size of r
 		bigMod.Mod(p, smallPrimesProduct)
 		mod := bigMod.Uint64()
 
 	NextDelta:
-		for delta, deltaMax := uint64(0), (uint64Max-mod)/r; delta < 1<<20 && delta <= deltaMax; delta += 2 {
-			m := mod + delta*r
+		for delta := uint64(0); delta < 1<<20; delta += 2 {
 			for _, prime := range smallPrimes {
-				if m%uint64(prime) == 0 && (bits > 6 || m != uint64(prime)) {
+				q := uint64(prime)
+				m := (mod%q + (delta%q)*(rMod%q)) % q
+				// below 64 bits p and r fit in a uint64
+				if m == 0 && (bits > 6 || p.Uint64()+delta*r.Uint64() != q) {
 					continue NextDelta
 				}
 			}
 
 			if delta > 0 {
-				bigMod.SetUint64(delta * r)
-				p.Add(p, bigMod)
+				bigMod.SetUint64(delta)
+				p.Add(p, bigMod.Mul(bigMod, r))
 			}
 			break
 		}
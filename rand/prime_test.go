@@ -13,12 +13,30 @@ func TestRandomPSIRand(t *testing.T) {
 	rnd := mRand.New(mRand.NewSource(69))
 	r := uint64(1000000007)
 	rBig := new(big.Int).SetUint64(r)
-	p, err := Prime(rnd, 1024, r)
+	p, err := Prime(rnd, 1024, rBig)
 	assert.Equal(err, nil, "Expected no error for big bits")
 	bigMod := new(big.Int).Mod(p, rBig)
 	assert.Equal(bigMod.Uint64(), uint64(1), "Expected the prime to have residue 1 when divided by r")
 }
 
+func TestBigR(t *testing.T) {
+	assert := assert.New(t)
+	rnd := mRand.New(mRand.NewSource(69))
+	// 2 ** 200 * 3 ** 50 has 280 bits
+	r := new(big.Int).Lsh(oneInt, 200)
+	r.Mul(r, new(big.Int).Exp(big.NewInt(3), big.NewInt(50), nil))
+	p, err := Prime(rnd, 512, r)
+	assert.Nil(err)
+	assert.True(p.ProbablyPrime(20))
+	assert.Equal(512, p.BitLen())
+	assert.Equal(oneInt, new(big.Int).Mod(p, r), "Expected r to divide p - 1")
+
+	for _, r := range []*big.Int{big.NewInt(0), big.NewInt(-3), new(big.Int).Lsh(oneInt, 511)} {
+		_, err := Prime(rnd, 512, r)
+		assert.NotNil(err, "Expected an error for r = %v", r)
+	}
+}
+
 func BenchmarkRandomCryptoRand(b *testing.B) {
 	rnd := mRand.New(mRand.NewSource(669))
 	r := uint64(667)